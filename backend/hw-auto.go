@@ -0,0 +1,123 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Selects the devices automatic setup installs configs for. Empty fields select all.
+type Hw_auto_install struct {
+	Kinds []Hw_kind
+	// Class ID like "0280", or a base class prefix like "02" for all network controllers
+	Class_id     string
+	Sysfs_bus_id string
+	Free_only    bool
+	// Only choose the configs without installing them
+	Dry_run bool
+}
+
+// Config chosen for a device by automatic setup.
+type Hw_auto_install_choice struct {
+	Kind         Hw_kind
+	Sysfs_bus_id string
+	Model        string
+	Class_id     string
+
+	// Chosen config, empty if no available config is suitable
+	Config    string
+	Installed bool
+	// Why no config was chosen or why installing it failed
+	Error string
+}
+
+// Chooses the recommended config for each selected device with configs available and installs
+// the choices that are not installed yet, in device order. Stops at the first failing install.
+func auto_install_configs(request Hw_auto_install) ([]Hw_auto_install_choice, error) {
+	kinds := request.Kinds
+	if len(kinds) == 0 {
+		kinds = []Hw_kind{Pci_kind, Usb_kind}
+	}
+
+	var choices []Hw_auto_install_choice
+
+	kernels := get_recommend_kernels()
+	for _, kind := range kinds {
+		ctx := new_recommend_context(kind, request.Free_only, kernels)
+
+		devices := get_devices_of_kind(kind)
+		for i := range *devices {
+			dev := &(*devices)[i]
+			if len(dev.Available_configs) == 0 || !is_auto_install_selected(&request, dev) {
+				continue
+			}
+
+			choice := Hw_auto_install_choice{Kind: kind, Sysfs_bus_id: dev.Sysfs_bus_id, Model: dev.Model,
+				Class_id: dev.Class_id}
+
+			rec := ctx.recommend(dev)
+			choice.Config = rec.Config
+			if choice.Config == "" {
+				choice.Error = strings.Join(rec.Reasons, "; ")
+			} else {
+				choice.Installed = find_config(get_installed_configs(kind), choice.Config) != nil
+			}
+
+			choices = append(choices, choice)
+		}
+	}
+
+	if request.Dry_run {
+		return choices, nil
+	}
+
+	var installed []string
+	for i := range choices {
+		choice := &choices[i]
+		if choice.Config == "" {
+			continue
+		}
+
+		// Devices sharing a config, or a previous config pulling it in as dependency
+		if choice.Installed || find_config(get_installed_configs(choice.Kind), choice.Config) != nil ||
+			slices.Contains(installed, choice.Kind.String()+"/"+choice.Config) {
+			choice.Installed = true
+			continue
+		}
+
+		if err := install_config(choice.Kind, choice.Config); err != nil {
+			choice.Error = err.Error()
+			return choices, fmt.Errorf("failed to install %s for %s: %w", choice.Config, choice.Sysfs_bus_id, err)
+		}
+		choice.Installed = true
+		installed = append(installed, choice.Kind.String()+"/"+choice.Config)
+	}
+
+	return choices, nil
+}
+
+// Updates the choices of a dry run after the transaction. The installs stop at the first
+// failure, the first choice not installed gets the error.
+func set_auto_install_results(choices []Hw_auto_install_choice, result Hw_transaction_result) {
+	// Nothing to report if the transaction succeeded
+	reported := result.Ok
+	for i := range choices {
+		choice := &choices[i]
+		if choice.Config == "" {
+			continue
+		}
+
+		choice.Installed = find_config(get_installed_configs(choice.Kind), choice.Config) != nil
+		if !choice.Installed && !reported {
+			choice.Error = result.Error
+			reported = true
+		}
+	}
+}
+
+func is_auto_install_selected(request *Hw_auto_install, dev *Hw_device) bool {
+	if request.Sysfs_bus_id != "" && dev.Sysfs_bus_id != request.Sysfs_bus_id {
+		return false
+	}
+	return strings.HasPrefix(dev.Class_id, request.Class_id)
+}
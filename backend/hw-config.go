@@ -4,13 +4,15 @@ import (
 	"bufio"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 )
 
 const hw_mhwd_cfg_name = "MHWDCONFIG"
-const hw_mhwd_usb_cfg_dir = "/var/lib/mhwd/db/usb"
-const hw_mhwd_pci_cfg_dir = "/var/lib/mhwd/db/pci"
+const hw_mhwd_cfg_dir = "/var/lib/mhwd/db"
+const hw_mhwd_etc_cfg_dir = "/etc/mhwd/db"
 const hw_mhwd_usb_db_dir = "/var/lib/mhwd/local/usb"
 const hw_mhwd_pci_db_dir = "/var/lib/mhwd/local/pci"
 const hw_mhwd_script_path = "/var/lib/mhwd/scripts/mhwd"
@@ -21,11 +23,14 @@ const hw_pm_root = "/"
 
 type Hw_ids struct {
 	Class_ids, Vendor_ids, Device_ids []string
+	Subvendor_ids, Subdevice_ids      []string
 }
 
 type Hw_config_ids struct {
 	Hw        Hw_ids
 	Blacklist Hw_ids
+
+	index *hw_ids_index
 }
 
 type Hw_config struct {
@@ -38,8 +43,29 @@ type Hw_config struct {
 	Freedriver              bool
 	Priority                int
 	Conflicts, Dependencies []string
+	Packages, Packages_64   []string
+
+	// Version of the database config if it is newer than this installed config
+	Update_version string
+
+	Diagnostics []Hw_config_diagnostic
+
+	// Paths of configs with the same name in config roots of lower precedence
+	Shadowed []string
+}
+
+// Problem found while reading a config file. Errors make the config invalid, other problems
+// are reported only.
+type Hw_config_diagnostic struct {
+	File    string
+	Line    int
+	Key     string
+	Problem string
+	Error   bool
 }
 
+var hw_config_function_regex = regexp.MustCompile(`^(function\s+)?[A-Za-z_][A-Za-z0-9_]*\s*\(\)`)
+
 func Update_configs() {
 	// Clear config vectors in each device element
 	for i := range Hwmgr.Pci_devices {
@@ -51,13 +77,14 @@ func Update_configs() {
 
 	Hwmgr.All_pci_configs = nil
 	Hwmgr.All_usb_configs = nil
+	Hwmgr.Invalid_configs = nil
 
 	// Refill data
 	fill_all_configs(Pci_kind)
 	fill_all_configs(Usb_kind)
 
-	set_matching_configs(&Hwmgr.Pci_devices, &Hwmgr.All_pci_configs, false)
-	set_matching_configs(&Hwmgr.Usb_devices, &Hwmgr.All_usb_configs, false)
+	set_matching_configs(&Hwmgr.Pci_devices, &Hwmgr.All_pci_configs, Hwmgr.pci_config_index, false)
+	set_matching_configs(&Hwmgr.Usb_devices, &Hwmgr.All_usb_configs, Hwmgr.usb_config_index, false)
 
 	// Update also installed config data
 	update_installed_configs()
@@ -74,34 +101,67 @@ func update_installed_configs() {
 
 	Hwmgr.Installed_pci_configs = nil
 	Hwmgr.Installed_usb_configs = nil
+	Hwmgr.Invalid_configs = slices.DeleteFunc(Hwmgr.Invalid_configs, func(cfg Hw_config) bool {
+		return strings.HasPrefix(cfg.Config_path, hw_path(hw_mhwd_pci_db_dir)) ||
+			strings.HasPrefix(cfg.Config_path, hw_path(hw_mhwd_usb_db_dir))
+	})
 
 	// Refill data
 	fill_installed_configs(Pci_kind)
 	fill_installed_configs(Usb_kind)
+	set_config_updates(Pci_kind)
+	set_config_updates(Usb_kind)
+
+	set_matching_configs(&Hwmgr.Pci_devices, &Hwmgr.Installed_pci_configs, nil, true)
+	set_matching_configs(&Hwmgr.Usb_devices, &Hwmgr.Installed_usb_configs, nil, true)
+	set_device_updates(Hwmgr.Pci_devices)
+	set_device_updates(Hwmgr.Usb_devices)
+}
 
-	set_matching_configs(&Hwmgr.Pci_devices, &Hwmgr.Installed_pci_configs, true)
-	set_matching_configs(&Hwmgr.Usb_devices, &Hwmgr.Installed_usb_configs, true)
+// returns the roots searched for configs, each with pci and usb subdirectories. Earlier roots
+// take precedence: the user-supplied directories, then site-specific configs in /etc/mhwd/db and
+// last the distribution configs in /var/lib/mhwd/db. A config shadows all configs of the same
+// kind and name in later roots.
+func Get_config_roots() []string {
+	roots := slices.Clone(Hwmgr.Config_dirs)
+	return append(roots, hw_path(hw_mhwd_etc_cfg_dir), hw_path(hw_mhwd_cfg_dir))
 }
 
 func fill_all_configs(kind Hw_kind) {
-	var config_paths []string
-	var configs *[]Hw_config
+	configs := get_all_configs(kind)
+	// Root of each config by name
+	config_roots := map[string]string{}
+
+	for _, root := range Get_config_roots() {
+		config_paths := get_recursive_directory_file_list(filepath.Join(root, kind.String()), hw_mhwd_cfg_name)
+
+		for _, path := range config_paths {
+			var cfg Hw_config
+			if !fill_config(&cfg, path, kind) {
+				Hwmgr.Invalid_configs = append(Hwmgr.Invalid_configs, cfg)
+				continue
+			}
 
-	if kind == Usb_kind {
-		configs = &Hwmgr.All_usb_configs
-		config_paths = get_recursive_directory_file_list(hw_mhwd_usb_cfg_dir, hw_mhwd_cfg_name)
-	} else {
-		configs = &Hwmgr.All_pci_configs
-		config_paths = get_recursive_directory_file_list(hw_mhwd_pci_cfg_dir, hw_mhwd_cfg_name)
+			shadowing := find_config(configs, cfg.Name)
+			switch {
+			case shadowing != nil && config_roots[cfg.Name] == root:
+				// Only a root of higher precedence may override a config
+				add_config_error(&cfg, path, 0, "name",
+					"duplicate name '"+cfg.Name+"', also used by "+shadowing.Config_path)
+				Hwmgr.Invalid_configs = append(Hwmgr.Invalid_configs, cfg)
+			case shadowing != nil:
+				shadowing.Shadowed = append(shadowing.Shadowed, cfg.Config_path)
+			default:
+				config_roots[cfg.Name] = root
+				*configs = append(*configs, cfg)
+			}
+		}
 	}
 
-	for _, path := range config_paths {
-		var cfg Hw_config
-		if fill_config(&cfg, path, kind) {
-			*configs = append(*configs, cfg)
-		} else {
-			Hwmgr.Invalid_configs = append(Hwmgr.Invalid_configs, cfg)
-		}
+	if kind == Usb_kind {
+		Hwmgr.usb_config_index = new_hw_config_index(*configs)
+	} else {
+		Hwmgr.pci_config_index = new_hw_config_index(*configs)
 	}
 }
 
@@ -111,10 +171,10 @@ func fill_installed_configs(kind Hw_kind) {
 
 	if kind == Usb_kind {
 		configs = &Hwmgr.Installed_usb_configs
-		config_paths = get_recursive_directory_file_list(hw_mhwd_usb_db_dir, hw_mhwd_cfg_name)
+		config_paths = get_recursive_directory_file_list(hw_path(hw_mhwd_usb_db_dir), hw_mhwd_cfg_name)
 	} else {
 		configs = &Hwmgr.Installed_pci_configs
-		config_paths = get_recursive_directory_file_list(hw_mhwd_pci_db_dir, hw_mhwd_cfg_name)
+		config_paths = get_recursive_directory_file_list(hw_path(hw_mhwd_pci_db_dir), hw_mhwd_cfg_name)
 	}
 
 	for _, path := range config_paths {
@@ -140,10 +200,45 @@ func fill_config(cfg *Hw_config, config_path string, kind Hw_kind) bool {
 
 	cfg.Hw = append(cfg.Hw, new_hw_config_ids())
 
-	return read_config_file(cfg, config_path)
+	if !read_config_file(cfg, config_path, nil) {
+		add_config_error(cfg, config_path, 0, "", "can't read config file")
+	} else if cfg.Name == "" {
+		add_config_error(cfg, config_path, 0, "name", "missing NAME")
+	}
+	index_config_ids(cfg)
+
+	return !slices.ContainsFunc(cfg.Diagnostics, func(diag Hw_config_diagnostic) bool {
+		return diag.Error
+	})
+}
+
+// returns the diagnostics of all valid and invalid configs
+func Get_config_diagnostics() []Hw_config_diagnostic {
+	var diagnostics []Hw_config_diagnostic
+
+	for _, configs := range [][]Hw_config{Hwmgr.All_pci_configs, Hwmgr.All_usb_configs,
+		Hwmgr.Installed_pci_configs, Hwmgr.Installed_usb_configs, Hwmgr.Invalid_configs} {
+		for _, cfg := range configs {
+			diagnostics = append(diagnostics, cfg.Diagnostics...)
+		}
+	}
+
+	return diagnostics
 }
 
-func read_config_file(config *Hw_config, config_path string) bool {
+func add_config_error(config *Hw_config, file string, line int, key, problem string) {
+	config.Diagnostics = append(config.Diagnostics, Hw_config_diagnostic{
+		File: file, Line: line, Key: key, Problem: problem, Error: true})
+}
+
+func add_config_warning(config *Hw_config, file string, line int, key, problem string) {
+	config.Diagnostics = append(config.Diagnostics, Hw_config_diagnostic{
+		File: file, Line: line, Key: key, Problem: problem})
+}
+
+// Reads the file into the config and records problems as diagnostics. Returns false if the file
+// can't be opened. The includes are the files currently being read, used to detect cycles.
+func read_config_file(config *Hw_config, config_path string, includes []string) bool {
 	if len(config.Hw) == 0 {
 		panic("Config Hw is empty")
 	}
@@ -156,8 +251,12 @@ func read_config_file(config *Hw_config, config_path string) bool {
 
 	scanner := bufio.NewScanner(file)
 
+	line_nr := 0
+	var functions config_function_tracker
+
 	for scanner.Scan() {
 		line := scanner.Text()
+		line_nr++
 
 		// Remove comments
 		if pos := strings.Index(line, "#"); pos != -1 {
@@ -170,6 +269,9 @@ func read_config_file(config *Hw_config, config_path string) bool {
 			continue
 		}
 
+		// Shell functions like post_install, their assignments are no config keys
+		was_in_function := functions.in_function(line)
+
 		// Split line by `=`
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
@@ -183,7 +285,9 @@ func read_config_file(config *Hw_config, config_path string) bool {
 			ext_file_path := get_right_config_path(value[1:], config.Base_path)
 			ext_file, err := os.Open(ext_file_path)
 			if err != nil {
-				return false
+				add_config_error(config, config_path, line_nr, key,
+					"can't read external file '"+ext_file_path+"': "+err.Error())
+				continue
 			}
 			defer ext_file.Close()
 
@@ -215,7 +319,14 @@ func read_config_file(config *Hw_config, config_path string) bool {
 		// Process each key
 		switch key {
 		case "include":
-			read_config_file(config, get_right_config_path(value, config.Base_path))
+			include_path := get_right_config_path(value, config.Base_path)
+			includes := append(slices.Clone(includes), config_path)
+			if slices.Contains(includes, include_path) {
+				add_config_error(config, config_path, line_nr, key,
+					"include cycle: "+strings.Join(append(includes, include_path), " -> "))
+			} else if !read_config_file(config, include_path, includes) {
+				add_config_error(config, config_path, line_nr, key, "failed to include '"+include_path+"'")
+			}
 		case "name":
 			config.Name = strings.ToLower(value)
 		case "version":
@@ -226,12 +337,17 @@ func read_config_file(config *Hw_config, config_path string) bool {
 			priority, err := strconv.Atoi(value)
 			if err == nil {
 				config.Priority = priority
+			} else {
+				add_config_warning(config, config_path, line_nr, key, "PRIORITY '"+value+"' is not a number")
 			}
 		case "freedriver":
 			if strings.ToLower(value) == "true" {
 				config.Freedriver = true
 			} else if strings.ToLower(value) == "false" {
 				config.Freedriver = false
+			} else {
+				add_config_warning(config, config_path, line_nr, key,
+					"FREEDRIVER '"+value+"' is neither true nor false")
 			}
 		case "classids":
 			// Add new HardwareIDs group to slice if not empty
@@ -239,28 +355,62 @@ func read_config_file(config *Hw_config, config_path string) bool {
 				config.Hw = append(config.Hw, new_hw_config_ids())
 			}
 			config.Hw[len(config.Hw)-1].Hw.Class_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
 		case "vendorids":
 			// Add new HardwareIDs group to slice if not empty
 			if len(config.Hw[len(config.Hw)-1].Hw.Vendor_ids) != 0 {
 				config.Hw = append(config.Hw, new_hw_config_ids())
 			}
 			config.Hw[len(config.Hw)-1].Hw.Vendor_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
 		case "deviceids":
 			// Add new HardwareIDs group to slice if not empty
 			if len(config.Hw[len(config.Hw)-1].Hw.Device_ids) != 0 {
 				config.Hw = append(config.Hw, new_hw_config_ids())
 			}
 			config.Hw[len(config.Hw)-1].Hw.Device_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
+		case "subvendorids":
+			// Add new HardwareIDs group to slice if not empty
+			if len(config.Hw[len(config.Hw)-1].Hw.Subvendor_ids) != 0 {
+				config.Hw = append(config.Hw, new_hw_config_ids())
+			}
+			config.Hw[len(config.Hw)-1].Hw.Subvendor_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
+		case "subdeviceids":
+			// Add new HardwareIDs group to slice if not empty
+			if len(config.Hw[len(config.Hw)-1].Hw.Subdevice_ids) != 0 {
+				config.Hw = append(config.Hw, new_hw_config_ids())
+			}
+			config.Hw[len(config.Hw)-1].Hw.Subdevice_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
 		case "blacklistedclassids":
 			config.Hw[len(config.Hw)-1].Blacklist.Class_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
 		case "blacklistedvendorids":
 			config.Hw[len(config.Hw)-1].Blacklist.Vendor_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
 		case "blacklisteddeviceids":
 			config.Hw[len(config.Hw)-1].Blacklist.Device_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
+		case "blacklistedsubvendorids":
+			config.Hw[len(config.Hw)-1].Blacklist.Subvendor_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
+		case "blacklistedsubdeviceids":
+			config.Hw[len(config.Hw)-1].Blacklist.Subdevice_ids = split_value(value, "")
+			check_config_ids(config, config_path, line_nr, key)
 		case "mhwddepends":
 			config.Dependencies = split_value(value, "")
 		case "mhwdconflicts":
 			config.Conflicts = split_value(value, "")
+		case "depends":
+			config.Packages = split_value(value, "")
+		case "depends_64":
+			config.Packages_64 = split_value(value, "")
+		default:
+			if !was_in_function {
+				add_config_warning(config, config_path, line_nr, key, "unknown key")
+			}
 		}
 	}
 
@@ -275,38 +425,138 @@ func read_config_file(config *Hw_config, config_path string) bool {
 		if len(config.Hw[i].Hw.Device_ids) == 0 {
 			config.Hw[i].Hw.Device_ids = append(config.Hw[i].Hw.Device_ids, "*")
 		}
+		if len(config.Hw[i].Hw.Subvendor_ids) == 0 {
+			config.Hw[i].Hw.Subvendor_ids = append(config.Hw[i].Hw.Subvendor_ids, "*")
+		}
+		if len(config.Hw[i].Hw.Subdevice_ids) == 0 {
+			config.Hw[i].Hw.Subdevice_ids = append(config.Hw[i].Hw.Subdevice_ids, "*")
+		}
+	}
+
+	return true
+}
+
+// Tracks the shell functions of a config file, like post_install.
+type config_function_tracker struct {
+	inside bool
+	depth  int
+}
+
+// returns whether the line, without comment, is part of a shell function
+func (tracker *config_function_tracker) in_function(line string) bool {
+	if hw_config_function_regex.MatchString(line) {
+		tracker.inside, tracker.depth = true, 0
+	}
+	inside := tracker.inside
+	if tracker.inside {
+		tracker.depth += strings.Count(line, "{") - strings.Count(line, "}")
+		if tracker.depth <= 0 && strings.Contains(line, "}") {
+			tracker.inside = false
+		}
+	}
+	return inside
+}
+
+// Warns about IDs of the key in the current ID group that are not 4-digit hex numbers.
+func check_config_ids(config *Hw_config, config_path string, line_nr int, key string) {
+	group := &config.Hw[len(config.Hw)-1]
+
+	var ids []string
+	switch key {
+	case "classids":
+		ids = group.Hw.Class_ids
+	case "vendorids":
+		ids = group.Hw.Vendor_ids
+	case "deviceids":
+		ids = group.Hw.Device_ids
+	case "subvendorids":
+		ids = group.Hw.Subvendor_ids
+	case "subdeviceids":
+		ids = group.Hw.Subdevice_ids
+	case "blacklistedclassids":
+		ids = group.Blacklist.Class_ids
+	case "blacklistedvendorids":
+		ids = group.Blacklist.Vendor_ids
+	case "blacklisteddeviceids":
+		ids = group.Blacklist.Device_ids
+	case "blacklistedsubvendorids":
+		ids = group.Blacklist.Subvendor_ids
+	case "blacklistedsubdeviceids":
+		ids = group.Blacklist.Subdevice_ids
 	}
 
-	// If the name is empty, return false
-	return config.Name != ""
+	for _, id := range ids {
+		if id == "*" && !strings.HasPrefix(key, "blacklisted") {
+			continue
+		}
+		if len(id) != 4 || !is_hex(id) {
+			add_config_warning(config, config_path, line_nr, key, "'"+id+"' is not a 4-digit hex ID")
+		}
+	}
 }
 
 // returns the correct path by prepending base if necessary
 func get_right_config_path(str, base string) string {
 	str = strings.TrimSpace(str)
 
-	if len(str) == 0 || strings.HasPrefix(str, "/") {
+	if len(str) == 0 {
 		return str
 	}
+	// Absolute paths refer to the system the configs are matched for
+	if strings.HasPrefix(str, "/") {
+		return hw_path(str)
+	}
 
 	return filepath.Join(base, str)
 }
 
-func set_matching_configs(devices *[]Hw_device, configs *[]Hw_config, set_as_installed bool) {
-	for _, cfg := range *configs {
-		set_matching_config(devices, &cfg, set_as_installed)
+// Adds the configs to the devices they match. Like get_devices_of_config, every ID group of a
+// config has to match a device. The index of the configs is built if none is given.
+func set_matching_configs(devices *[]Hw_device, configs *[]Hw_config, index *hw_config_index,
+	set_as_installed bool) {
+	if index == nil {
+		index = new_hw_config_index(*configs)
 	}
-}
 
-func set_matching_config(devices *[]Hw_device, config *Hw_config, set_as_installed bool) {
-	found_devices := get_devices_of_config(devices, config)
+	// Matching devices by config and ID group
+	matched := make([][][]*Hw_device, len(*configs))
+	for i := range *devices {
+		dev := &(*devices)[i]
 
-	// Set config to all matching devices
-	for _, dev := range found_devices {
-		if set_as_installed {
-			add_config_sorted(&dev.Installed_configs, config)
-		} else {
-			add_config_sorted(&dev.Available_configs, config)
+		for _, ref := range index.candidates(dev) {
+			config := &(*configs)[ref.config]
+			if matched[ref.config] == nil {
+				matched[ref.config] = make([][]*Hw_device, len(config.Hw))
+			}
+
+			// IDs listed twice reference a group twice
+			group := &matched[ref.config][ref.group]
+			if len(*group) != 0 && (*group)[len(*group)-1] == dev {
+				continue
+			}
+			if ok, _ := match_ids(&config.Hw[ref.group], dev); ok {
+				*group = append(*group, dev)
+			}
+		}
+	}
+
+	for i := range *configs {
+		if matched[i] == nil || slices.ContainsFunc(matched[i], func(group []*Hw_device) bool {
+			return len(group) == 0
+		}) {
+			continue
+		}
+
+		// Set config to all matching devices
+		config := &(*configs)[i]
+		for _, group := range matched[i] {
+			for _, dev := range group {
+				if set_as_installed {
+					add_config_sorted(&dev.Installed_configs, config)
+				} else {
+					add_config_sorted(&dev.Available_configs, config)
+				}
+			}
 		}
 	}
 }
@@ -341,7 +591,7 @@ func add_config_sorted(configs *[]*Hw_config, config *Hw_config) {
 	for i, exist := range *configs {
 		if config.Priority > exist.Priority {
 			// Insert config into the slice while maintaining priority order
-			*configs = append((*configs)[:i], append([]*Hw_config{config}, (*configs)[i:]...)...)
+			*configs = slices.Insert(*configs, i, config)
 			return
 		}
 	}
@@ -351,19 +601,12 @@ func add_config_sorted(configs *[]*Hw_config, config *Hw_config) {
 }
 
 // returns a list of file paths in the directory and its subdirectories that match the given
-// filename (if provided).
+// filename (if provided), sorted by path so duplicates are resolved the same way on every run.
 func get_recursive_directory_file_list(dir_path string, only_filename string) []string {
 	var list []string
 
-	// Open the directory
-	dir, err := os.Open(dir_path)
-	if err != nil {
-		return list
-	}
-	defer dir.Close()
-
-	// Read directory contents
-	files, err := dir.Readdir(-1)
+	// Read directory contents, sorted by name
+	files, err := os.ReadDir(dir_path)
 	if err != nil {
 		return list
 	}
@@ -372,13 +615,8 @@ func get_recursive_directory_file_list(dir_path string, only_filename string) []
 		filename := file.Name()
 		filepath := filepath.Join(dir_path, filename)
 
-		// Skip "." and ".."
-		if filename == "." || filename == ".." {
-			continue
-		}
-
 		// If the file is a regular file, check if it matches the filename filter
-		if file.Mode().IsRegular() && (only_filename == "" || only_filename == filename) {
+		if file.Type().IsRegular() && (only_filename == "" || only_filename == filename) {
 			list = append(list, filepath)
 
 			// If the file is a directory, recurse into it
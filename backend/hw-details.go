@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"bufio"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const hw_modules_dir = "/lib/modules"
+const hw_kernel_release_path = "/proc/sys/kernel/osrelease"
+
+// Firmware declared by a module, by kernel release and module name. Modules don't change while
+// the kernel runs, rescans reuse them.
+var hw_module_firmware = map[string][]string{}
+var hw_module_firmware_mutex sync.Mutex
+
+// Module aliases of the running kernel, like "pci:v00008086d*sv*sd*bc03sc*i*" for i915.
+type hw_module_alias struct {
+	pattern, module string
+}
+
+// Adds the driver state and bus details of the devices read from sysfs.
+func fill_device_details(devices []Hw_device) {
+	release := read_sysfs_string(hw_path(filepath.Dir(hw_kernel_release_path)),
+		filepath.Base(hw_kernel_release_path))
+	aliases := load_module_aliases(release)
+
+	for i := range devices {
+		dev := &devices[i]
+		if dev.Sysfs_id == "" {
+			continue
+		}
+		dir := hw_path(filepath.Join(hw_sysfs_dir, dev.Sysfs_id))
+
+		// USB devices are bound to the generic usb driver, their drivers bind to the interfaces
+		driver_dirs := []string{dir}
+		if dev.Kind == Usb_kind {
+			driver_dirs = get_usb_interface_dirs(dir)
+		}
+
+		driver_dir := ""
+		for _, d := range driver_dirs {
+			if driver, err := os.Readlink(filepath.Join(d, "driver")); err == nil && dev.Driver == "" {
+				dev.Driver = filepath.Base(driver)
+				driver_dir = d
+			}
+			if modalias := read_sysfs_string(d, "modalias"); modalias != "" {
+				for _, module := range get_alias_modules(aliases, modalias) {
+					if !slices.Contains(dev.Modules, module) {
+						dev.Modules = append(dev.Modules, module)
+					}
+				}
+			}
+		}
+		if group, err := os.Readlink(filepath.Join(dir, "iommu_group")); err == nil {
+			dev.Iommu_group = filepath.Base(group)
+		}
+
+		dev.Boot_vga = read_sysfs_string(dir, "boot_vga") == "1"
+
+		// No NUMA affinity is reported as -1
+		if node := read_sysfs_string(dir, "numa_node"); node != "-1" {
+			dev.Numa_node = node
+		}
+
+		dev.Link_speed = read_sysfs_string(dir, "current_link_speed")
+		dev.Link_width = read_sysfs_string(dir, "current_link_width")
+		dev.Max_link_speed = read_sysfs_string(dir, "max_link_speed")
+		dev.Max_link_width = read_sysfs_string(dir, "max_link_width")
+
+		if dev.Driver != "" && release != "" {
+			dev.Module_firmware = get_module_firmware(get_driver_module(driver_dir, dev.Driver), release)
+		}
+	}
+}
+
+// Parses modules.alias of the kernel release.
+func load_module_aliases(release string) []hw_module_alias {
+	var aliases []hw_module_alias
+	if release == "" {
+		return aliases
+	}
+
+	file, err := os.Open(hw_path(filepath.Join(hw_modules_dir, release, "modules.alias")))
+	if err != nil {
+		return aliases
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// alias pci:v00008086d00003E9Bsv*sd*bc03sc*i* i915
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 3 && fields[0] == "alias" {
+			aliases = append(aliases, hw_module_alias{pattern: fields[1], module: fields[2]})
+		}
+	}
+
+	return aliases
+}
+
+// returns the modules with an alias matching the modalias of a device
+func get_alias_modules(aliases []hw_module_alias, modalias string) []string {
+	var modules []string
+
+	for _, alias := range aliases {
+		if matched, _ := path.Match(alias.pattern, modalias); !matched {
+			continue
+		}
+		if !slices.Contains(modules, alias.module) {
+			modules = append(modules, alias.module)
+		}
+	}
+
+	return modules
+}
+
+// returns the module providing the driver. Built-in drivers have no module link, their driver
+// name is used as module name then.
+func get_driver_module(device_dir, driver string) string {
+	if module, err := os.Readlink(filepath.Join(device_dir, "driver", "module")); err == nil {
+		return filepath.Base(module)
+	}
+	return strings.ReplaceAll(driver, "-", "_")
+}
+
+// returns the firmware files declared by the module
+func get_module_firmware(module, release string) []string {
+	hw_module_firmware_mutex.Lock()
+	defer hw_module_firmware_mutex.Unlock()
+
+	key := hw_root + " " + release + " " + module
+	if firmware, found := hw_module_firmware[key]; found {
+		return firmware
+	}
+
+	cmd := exec.Command("modinfo", "-b", hw_root, "-k", release, "-F", "firmware", module)
+	cmd.Env = append(os.Environ(), "LANG=C", "LC_MESSAGES=C")
+
+	var firmware []string
+	if output, err := cmd.Output(); err == nil {
+		firmware = strings.Fields(string(output))
+	}
+	hw_module_firmware[key] = firmware
+	return firmware
+}
@@ -7,104 +7,61 @@ const (
 	Pci_kind
 )
 
+// returns the bus name of the kind as used by mhwd ("usb" or "pci")
+func (kind Hw_kind) String() string {
+	if kind == Usb_kind {
+		return "usb"
+	}
+	return "pci"
+}
+
 type Hw_device struct {
 	Kind Hw_kind
 
 	Model                        string
 	Class_name, Class_id         string
+	Subclass_name                string
 	Device_name, Device_id       string
 	Vendor_name, Vendor_id       string
 	Subvendor_name, Subvendor_id string
+	Subdevice_name, Subdevice_id string
 	Sysfs_bus_id, Sysfs_id       string
+	Serial                       string
+
+	// Kernel driver bound to the device and the modules of the running kernel supporting it
+	Driver  string
+	Modules []string
+	// Firmware files the module of the bound driver declares it may request, as listed by modinfo.
+	// Which of them were loaded isn't known, see Get_missing_firmware for the failed ones.
+	Module_firmware []string
+
+	// Whether the firmware initialized the device as primary graphics adapter
+	Boot_vga bool
+
+	Iommu_group, Numa_node         string
+	Link_speed, Link_width         string
+	Max_link_speed, Max_link_width string
 
 	Available_configs, Installed_configs []*Hw_config
+	// Whether an installed config has a newer version in the database
+	Update_available bool
 }
 
 func get_devices_of_config(devices *[]Hw_device, config *Hw_config) []*Hw_device {
 	var found_devices []*Hw_device
 
 	// Loop through the hardware ids in the config
-	for _, ids := range config.Hw {
+	for i := range config.Hw {
 		found_device := false
 
 		// Loop through each device
 		for index := range *devices {
 			device := &(*devices)[index]
-			found := false
-
-			// Check class IDs
-			for _, id := range ids.Hw.Class_ids {
-				if id == "*" || id == device.Class_id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
 
-			// Check blacklisted class IDs
-			found = false
-			for _, id := range ids.Blacklist.Class_ids {
-				if id == device.Class_id {
-					found = true
-					break
-				}
+			if matched, _ := match_ids(&config.Hw[i], device); matched {
+				found_device = true
+				found_devices = append(found_devices, device)
 			}
-			if found {
-				continue
-			}
-
-			// Check vendor IDs
-			found = false
-			for _, id := range ids.Hw.Vendor_ids {
-				if id == "*" || id == device.Vendor_id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
-
-			// Check blacklisted vendor IDs
-			found = false
-			for _, id := range ids.Blacklist.Vendor_ids {
-				if id == device.Vendor_id {
-					found = true
-					break
-				}
-			}
-			if found {
-				continue
-			}
-
-			// Check device IDs
-			found = false
-			for _, id := range ids.Hw.Device_ids {
-				if id == "*" || id == device.Device_id {
-					found = true
-					break
-				}
-			}
-			if !found {
-				continue
-			}
-
-			// Check blacklisted device IDs
-			found = false
-			for _, id := range ids.Blacklist.Device_ids {
-				if id == device.Device_id {
-					found = true
-					break
-				}
-			}
-			if found {
-				continue
-			}
-
-			found_device = true
-			found_devices = append(found_devices, device)
 		}
 
 		// If no device found for the current HardwareIDs, clear the foundDevices and return
@@ -115,3 +72,25 @@ func get_devices_of_config(devices *[]Hw_device, config *Hw_config) []*Hw_device
 
 	return found_devices
 }
+
+// Checks the device against one group of hardware ids. If it doesn't match, also returns why.
+func match_ids(ids *Hw_config_ids, device *Hw_device) (bool, string) {
+	// Groups of configs not read by fill_config have no index yet
+	index := ids.index
+	if index == nil {
+		index = new_hw_ids_index(ids)
+	}
+
+	values := device.ids()
+	for i, key := range hw_ids_keys {
+		if !index.hw[i].matches(values[i]) {
+			return false, or_none(values[i]) + " is not in " + key
+		}
+
+		if index.blacklist[i].lists(values[i]) {
+			return false, values[i] + " is in BLACKLISTED" + key
+		}
+	}
+
+	return true, ""
+}
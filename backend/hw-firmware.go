@@ -0,0 +1,236 @@
+package backend
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+)
+
+const hw_kmsg_path = "/dev/kmsg"
+const hw_firmware_dir = "/usr/lib/firmware"
+
+// Firmware package by file name prefix, used when the pacman files database is not synced.
+//
+//go:embed firmware-packages.json
+var firmware_packages_json []byte
+
+type firmware_packages struct {
+	Default  string
+	Packages []firmware_package_prefix
+}
+
+type firmware_package_prefix struct {
+	Prefix  string `json:"prefix"`
+	Package string `json:"package"`
+}
+
+// Kernel log messages of failed firmware loads, like
+// "iwlwifi 0000:03:00.0: Direct firmware load for iwlwifi-8265-36.ucode failed with error -2" or
+// "r8169 0000:02:00.0: firmware: failed to load rtl_nic/rtl8168h-2.fw (-2)".
+var hw_firmware_failed_regex = regexp.MustCompile(
+	`^(\S+) (\S+): (?:Direct firmware load for (\S+) failed|firmware: failed to load (\S+))`)
+
+// Firmware file a driver failed to load since boot.
+type Hw_missing_firmware struct {
+	Driver string
+	// Device as named by the driver, a sysfs bus ID for PCI and USB devices
+	Bus_id string
+	File   string
+
+	// Model of the device with the bus ID, empty if it isn't a PCI or USB device
+	Model string
+	// Package providing the file, empty if unknown
+	Package string
+	// Whether the file exists by now, reloading the driver or a reboot picks it up then
+	Present bool
+}
+
+// returns the firmware files that failed to load since boot, with the packages providing them
+func Get_missing_firmware() []Hw_missing_firmware {
+	lines, err := read_kernel_log()
+	if err != nil {
+		log.Println("error: failed to read the kernel log:", err)
+		return nil
+	}
+
+	var missing []Hw_missing_firmware
+	for _, line := range lines {
+		matches := hw_firmware_failed_regex.FindStringSubmatch(line)
+		if matches == nil {
+			continue
+		}
+
+		fw := Hw_missing_firmware{Driver: matches[1], Bus_id: matches[2], File: matches[3] + matches[4]}
+		if slices.ContainsFunc(missing, func(other Hw_missing_firmware) bool {
+			return other.Bus_id == fw.Bus_id && other.File == fw.File
+		}) {
+			continue
+		}
+
+		if dev := find_device_by_bus_id(fw.Bus_id); dev != nil {
+			fw.Model = dev.Model
+		}
+		fw.Present = is_firmware_present(fw.File)
+		missing = append(missing, fw)
+	}
+
+	set_firmware_packages(missing)
+	return missing
+}
+
+// Reads the kernel messages of the current boot from /dev/kmsg, or from the journal if the kernel
+// ring buffer is not readable.
+func read_kernel_log() ([]string, error) {
+	lines, err := read_kmsg(hw_path(hw_kmsg_path))
+	if err == nil {
+		return lines, nil
+	}
+
+	output, journal_err := exec.Command("journalctl", "--dmesg", "--boot", "--output=cat",
+		"--no-pager").Output()
+	if journal_err != nil {
+		return nil, errors.Join(err, journal_err)
+	}
+	return strings.Split(string(output), "\n"), nil
+}
+
+// Reads all records buffered in /dev/kmsg. Records are "priority,sequence,timestamp,flags;message"
+// followed by continuation lines.
+func read_kmsg(path string) ([]string, error) {
+	fd, err := syscall.Open(path, syscall.O_RDONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.Close(fd)
+
+	var lines []string
+	buf := make([]byte, 8192)
+
+	for {
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EAGAIN || n == 0 {
+			break
+		}
+		// Records overwritten while reading are skipped
+		if err == syscall.EPIPE {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		record, _, _ := strings.Cut(string(buf[:n]), "\n")
+		if _, message, found := strings.Cut(record, ";"); found {
+			lines = append(lines, message)
+		}
+	}
+
+	return lines, nil
+}
+
+func find_device_by_bus_id(bus_id string) *Hw_device {
+	for _, devices := range []*[]Hw_device{&Hwmgr.Pci_devices, &Hwmgr.Usb_devices} {
+		for i := range *devices {
+			if (*devices)[i].Sysfs_bus_id == bus_id {
+				return &(*devices)[i]
+			}
+		}
+	}
+	return nil
+}
+
+// returns whether the file exists, also compressed
+func is_firmware_present(file string) bool {
+	for _, ext := range []string{"", ".zst", ".xz"} {
+		if _, err := os.Stat(hw_path(filepath.Join(hw_firmware_dir, file+ext))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Looks the packages up in the pacman files database, the local mapping is the fallback and
+// lists the packages that may be installed.
+func set_firmware_packages(missing []Hw_missing_firmware) {
+	mapping := get_firmware_package_mapping()
+
+	for i := range missing {
+		fw := &missing[i]
+		// Only packages of the mapping can be installed, see install_firmware_packages
+		if pkg := find_file_package(fw.File); is_firmware_package(pkg) {
+			fw.Package = pkg
+			continue
+		}
+
+		fw.Package = mapping.Default
+		longest := 0
+		for _, entry := range mapping.Packages {
+			// The longest prefix wins, like "intel/sof" over "intel/"
+			if strings.HasPrefix(fw.File, entry.Prefix) && len(entry.Prefix) > longest {
+				fw.Package, longest = entry.Package, len(entry.Prefix)
+			}
+		}
+	}
+}
+
+func get_firmware_package_mapping() firmware_packages {
+	var mapping firmware_packages
+	if err := json.Unmarshal(firmware_packages_json, &mapping); err != nil {
+		log.Println("error: invalid firmware package mapping:", err)
+	}
+	return mapping
+}
+
+// returns whether the package is one of the firmware packages of the mapping
+func is_firmware_package(pkg string) bool {
+	mapping := get_firmware_package_mapping()
+	if pkg == mapping.Default {
+		return pkg != ""
+	}
+	return slices.ContainsFunc(mapping.Packages, func(entry firmware_package_prefix) bool {
+		return entry.Package == pkg
+	})
+}
+
+// returns the package containing the firmware file according to the files database
+func find_file_package(file string) string {
+	regex := "^" + strings.TrimPrefix(hw_firmware_dir, "/") + "/" + regexp.QuoteMeta(file) + `(\.zst|\.xz)?$`
+
+	var out strings.Builder
+	if err := hw_run_cmd(&out, "pacman", append(get_pm_args(), "-F", "-q", "-x", regex)...); err != nil {
+		return ""
+	}
+
+	// "core/linux-firmware-intel", the first repository wins
+	repo_pkg, _, _ := strings.Cut(strings.TrimSpace(out.String()), "\n")
+	_, pkg, _ := strings.Cut(repo_pkg, "/")
+	return pkg
+}
+
+// Installs the packages providing the missing firmware. The drivers pick the files up after
+// being reloaded or a reboot.
+func install_firmware_packages(pkgs []string) error {
+	if len(pkgs) == 0 {
+		return errors.New("no firmware packages given")
+	}
+	for _, pkg := range pkgs {
+		if !is_firmware_package(pkg) {
+			return fmt.Errorf("'%s' is not a firmware package", pkg)
+		}
+	}
+
+	args := append(get_pm_args(), "-S", "--needed")
+	if err := hw_run_privileged_cmd(nil, "pacman", append(args, pkgs...)...); err != nil {
+		return fmt.Errorf("failed to install firmware packages: %w", err)
+	}
+	return nil
+}
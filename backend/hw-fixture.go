@@ -0,0 +1,220 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Recorded devices of a machine, replayed instead of probing the hardware. The devices are
+// either listed directly or read from a `hwinfo --pci --usb` dump next to the fixture.
+type Hw_fixture struct {
+	Description              string
+	Hwinfo_dump              string
+	Pci_devices, Usb_devices []Hw_device
+
+	// Expected available configs by Sysfs_bus_id, checked by Check_fixture
+	Expected map[string][]string
+}
+
+// Replays the devices of a fixture.
+type fixture_enumerator struct {
+	fixture *Hw_fixture
+}
+
+func (e fixture_enumerator) Devices(kind Hw_kind) []Hw_device {
+	// Callers modify the devices, hand out copies
+	if kind == Usb_kind {
+		return slices.Clone(e.fixture.Usb_devices)
+	}
+	return slices.Clone(e.fixture.Pci_devices)
+}
+
+// Replays the devices of the file, a fixture or a hwinfo dump, instead of probing the hardware.
+func Use_device_fixture(path string) error {
+	fixture, err := Load_fixture(path)
+	if err != nil {
+		return err
+	}
+	hw_enumerator = fixture_enumerator{fixture}
+	return nil
+}
+
+// Reads a JSON fixture or a plain hwinfo dump.
+func Load_fixture(path string) (*Hw_fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Hw_fixture
+
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		fixture.Pci_devices, fixture.Usb_devices = parse_hwinfo_dump(data)
+		return &fixture, nil
+	}
+
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+
+	if fixture.Hwinfo_dump != "" {
+		dump_path := fixture.Hwinfo_dump
+		if !filepath.IsAbs(dump_path) {
+			dump_path = filepath.Join(filepath.Dir(path), dump_path)
+		}
+		dump, err := os.ReadFile(dump_path)
+		if err != nil {
+			return nil, err
+		}
+		pci, usb := parse_hwinfo_dump(dump)
+		fixture.Pci_devices = append(fixture.Pci_devices, pci...)
+		fixture.Usb_devices = append(fixture.Usb_devices, usb...)
+	}
+
+	for i := range fixture.Pci_devices {
+		fixture.Pci_devices[i].Kind = Pci_kind
+	}
+	for i := range fixture.Usb_devices {
+		fixture.Usb_devices[i].Kind = Usb_kind
+	}
+
+	return &fixture, nil
+}
+
+// "22: PCI 200.0: 0300 VGA compatible controller (VGA)"
+var hwinfo_header_regex = regexp.MustCompile(`^\d+: (PCI|USB) [^:]*: ([0-9a-fA-F]{4}) (.*?)(?: \(.*\))?$`)
+
+// "Vendor: pci 0x10de "nVidia Corporation""
+var hwinfo_id_regex = regexp.MustCompile(`^(?:pci|usb) 0x([0-9a-fA-F]{4})(?: "(.*)")?`)
+
+// Parses the PCI and USB entries of `hwinfo --pci --usb` output.
+func parse_hwinfo_dump(data []byte) (pci, usb []Hw_device) {
+	var dev *Hw_device
+
+	flush := func() {
+		if dev == nil {
+			return
+		}
+		if dev.Kind == Usb_kind {
+			usb = append(usb, *dev)
+		} else {
+			pci = append(pci, *dev)
+		}
+		dev = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if !strings.HasPrefix(line, " ") {
+			flush()
+			if matches := hwinfo_header_regex.FindStringSubmatch(line); matches != nil {
+				dev = &Hw_device{Kind: Pci_kind, Class_id: strings.ToLower(matches[2])}
+				if matches[1] == "USB" {
+					dev.Kind = Usb_kind
+				}
+				dev.Subclass_name = strings.TrimSpace(matches[3])
+			}
+			continue
+		}
+		if dev == nil {
+			continue
+		}
+
+		key, value, found := strings.Cut(strings.TrimSpace(line), ": ")
+		if !found {
+			continue
+		}
+
+		id, name := "", ""
+		if matches := hwinfo_id_regex.FindStringSubmatch(value); matches != nil {
+			id, name = strings.ToLower(matches[1]), matches[2]
+		}
+
+		switch key {
+		case "SysFS ID":
+			dev.Sysfs_id = value
+		case "SysFS BusID":
+			dev.Sysfs_bus_id = value
+		case "Model":
+			dev.Model = strings.Trim(value, "\"")
+		case "Vendor":
+			dev.Vendor_id, dev.Vendor_name = id, name
+		case "Device":
+			dev.Device_id, dev.Device_name = id, name
+		case "SubVendor":
+			dev.Subvendor_id, dev.Subvendor_name = id, name
+		case "SubDevice":
+			dev.Subdevice_id, dev.Subdevice_name = id, name
+		case "Driver":
+			dev.Driver = strings.Trim(value, "\"")
+		case "Serial ID":
+			dev.Serial = strings.Trim(value, "\"")
+		}
+	}
+	flush()
+
+	return pci, usb
+}
+
+// Matches the configs of the config roots below root against the devices of the fixture and returns
+// the differences to the expected configs. The current devices and configs are restored afterwards.
+func Check_fixture(path, root string) ([]string, error) {
+	fixture, err := Load_fixture(path)
+	if err != nil {
+		return nil, err
+	}
+
+	saved_mgr, saved_enumerator, saved_root := Hwmgr, hw_enumerator, hw_root
+	defer func() {
+		Hwmgr, hw_enumerator, hw_root = saved_mgr, saved_enumerator, saved_root
+	}()
+
+	hw_root = root
+	hw_enumerator = fixture_enumerator{fixture}
+	Hwmgr.Pci_devices = hw_enumerator.Devices(Pci_kind)
+	Hwmgr.Usb_devices = hw_enumerator.Devices(Usb_kind)
+	fill_device_names(Hwmgr.Pci_devices)
+	fill_device_names(Hwmgr.Usb_devices)
+	Update_configs()
+
+	var problems []string
+	found := map[string]bool{}
+
+	for _, devices := range [][]Hw_device{Hwmgr.Pci_devices, Hwmgr.Usb_devices} {
+		for _, dev := range devices {
+			expected, checked := fixture.Expected[dev.Sysfs_bus_id]
+			if !checked {
+				continue
+			}
+			found[dev.Sysfs_bus_id] = true
+
+			var actual []string
+			for _, cfg := range dev.Available_configs {
+				actual = append(actual, cfg.Name)
+			}
+
+			if !slices.Equal(actual, expected) {
+				problems = append(problems, fmt.Sprintf("%s: expected [%s], matched [%s]", dev.Sysfs_bus_id,
+					strings.Join(expected, " "), strings.Join(actual, " ")))
+			}
+		}
+	}
+
+	for bus_id := range fixture.Expected {
+		if !found[bus_id] {
+			problems = append(problems, bus_id+": no such device in fixture")
+		}
+	}
+	slices.Sort(problems)
+
+	return problems, nil
+}
@@ -0,0 +1,286 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const hw_vulkan_icd_dir = "/usr/share/vulkan/icd.d"
+const hw_egl_vendor_dir = "/usr/share/glvnd/egl_vendor.d"
+const hw_lib_dir = "/usr/lib"
+const hw_lib32_dir = "/usr/lib32"
+
+// Xorg config written by the post_install of the mhwd video configs.
+const hw_mhwd_xorg_conf = "90-mhwd.conf"
+
+// `Driver "nvidia"` in a Device section
+var hw_xorg_driver_regex = regexp.MustCompile(`(?i)^\s*Driver\s+"([^"]+)"`)
+
+// "libGLX_nvidia.so.0"
+var hw_glvnd_vendor_regex = regexp.MustCompile(`^lib(?:GLX|EGL)_(.+)\.so\.0$`)
+
+type Hw_graphics_gpu struct {
+	Sysfs_bus_id, Model string
+	Vendor_id           string
+	// Kernel module bound to the GPU, empty if none
+	Driver            string
+	Installed_configs []string
+}
+
+type Hw_vulkan_icd struct {
+	File    string
+	Library string
+	Lib32   bool
+	// Whether the library the ICD points to exists
+	Present bool
+}
+
+type Hw_xorg_file struct {
+	File    string
+	Mhwd    bool
+	Drivers []string
+}
+
+// Active graphics stack and the inconsistencies found in it.
+type Hw_graphics_status struct {
+	Gpus        []Hw_graphics_gpu
+	Vulkan_icds []Hw_vulkan_icd
+	// GLVND vendor libraries like "mesa" or "nvidia"
+	Glx_vendors, Glx_vendors_32 []string
+	Egl_vendors                 []string
+	Xorg_files                  []Hw_xorg_file
+	Problems                    []string
+}
+
+func Get_graphics_status() Hw_graphics_status {
+	var status Hw_graphics_status
+
+	for _, gpu := range get_gpus() {
+		graphics_gpu := Hw_graphics_gpu{Sysfs_bus_id: gpu.Sysfs_bus_id, Model: gpu.Model,
+			Vendor_id: gpu.Vendor_id, Driver: gpu.Driver}
+		for _, cfg := range gpu.Installed_configs {
+			graphics_gpu.Installed_configs = append(graphics_gpu.Installed_configs, cfg.Name)
+		}
+		status.Gpus = append(status.Gpus, graphics_gpu)
+	}
+
+	status.Vulkan_icds = get_vulkan_icds()
+	status.Glx_vendors = get_glvnd_vendors(hw_lib_dir, "GLX")
+	status.Glx_vendors_32 = get_glvnd_vendors(hw_lib32_dir, "GLX")
+	status.Egl_vendors = get_egl_vendors()
+	status.Xorg_files = get_xorg_files()
+
+	status.Problems = check_graphics_status(&status)
+	return status
+}
+
+func check_graphics_status(status *Hw_graphics_status) []string {
+	var problems []string
+
+	nvidia_installed := false
+	for _, gpu := range status.Gpus {
+		name := or_none(gpu.Model) + " (" + gpu.Sysfs_bus_id + ")"
+
+		if gpu.Driver == "" {
+			problems = append(problems, "no kernel module is bound to "+name)
+		}
+
+		for _, cfg := range gpu.Installed_configs {
+			if gpu.Vendor_id != "10de" || !strings.Contains(cfg, "nvidia") {
+				continue
+			}
+			nvidia_installed = true
+			if gpu.Driver != "" && gpu.Driver != "nvidia" {
+				problems = append(problems, fmt.Sprintf("%s is installed, but %s is driven by %s", cfg, name, gpu.Driver))
+			}
+		}
+
+		// Open source kernel drivers need the Mesa user space
+		if slices.Contains([]string{"nouveau", "amdgpu", "radeon", "i915", "xe"}, gpu.Driver) &&
+			!slices.Contains(status.Glx_vendors, "mesa") {
+			problems = append(problems, name+" is driven by "+gpu.Driver+", but the Mesa GLX library is missing")
+		}
+	}
+
+	if nvidia_installed {
+		if !slices.Contains(status.Glx_vendors, "nvidia") {
+			problems = append(problems, "an NVIDIA config is installed, but the NVIDIA GLX library is missing")
+		}
+		if !slices.ContainsFunc(status.Vulkan_icds, func(icd Hw_vulkan_icd) bool {
+			return strings.Contains(icd.Library, "nvidia")
+		}) {
+			problems = append(problems, "an NVIDIA config is installed, but there is no NVIDIA Vulkan ICD")
+		}
+	}
+
+	for _, icd := range status.Vulkan_icds {
+		if !icd.Present {
+			problems = append(problems,
+				fmt.Sprintf("Vulkan ICD %s points to the missing library %s", icd.File, icd.Library))
+		}
+	}
+
+	for _, xorg := range status.Xorg_files {
+		if !xorg.Mhwd {
+			continue
+		}
+		if !slices.Contains(xorg.Drivers, "nvidia") {
+			continue
+		}
+		// A missing config is the cause of an unbound driver too, report it only
+		switch {
+		case !nvidia_installed:
+			problems = append(problems, xorg.File+" configures the nvidia driver, but no NVIDIA config is installed")
+		case !slices.ContainsFunc(status.Gpus, func(gpu Hw_graphics_gpu) bool {
+			return gpu.Driver == "nvidia"
+		}):
+			problems = append(problems, xorg.File+" configures the nvidia driver, but no GPU is driven by nvidia")
+		}
+	}
+
+	problems = append(problems, check_graphics_lib32(status)...)
+	return problems
+}
+
+// Steam and Wine run 32-bit applications, which need the 32-bit counterparts of the drivers.
+func check_graphics_lib32(status *Hw_graphics_status) []string {
+	var problems []string
+
+	packages, err := get_pm_installed_packages()
+	if err != nil || !slices.Contains(packages, "steam") {
+		return problems
+	}
+
+	for _, vendor := range status.Glx_vendors {
+		if !slices.Contains(status.Glx_vendors_32, vendor) {
+			problems = append(problems, "steam is installed, but the 32-bit GLX library of "+vendor+" is missing")
+		}
+	}
+
+	// Mesa ships an ICD per architecture, like radeon_icd.x86_64.json and radeon_icd.i686.json
+	for _, icd := range status.Vulkan_icds {
+		base, found := strings.CutSuffix(filepath.Base(icd.File), ".x86_64.json")
+		if !found {
+			continue
+		}
+		if !slices.ContainsFunc(status.Vulkan_icds, func(other Hw_vulkan_icd) bool {
+			return filepath.Base(other.File) == base+".i686.json"
+		}) {
+			problems = append(problems, "steam is installed, but the 32-bit Vulkan ICD "+base+".i686.json is missing")
+		}
+	}
+
+	return problems
+}
+
+func get_vulkan_icds() []Hw_vulkan_icd {
+	var icds []Hw_vulkan_icd
+
+	files, _ := filepath.Glob(filepath.Join(hw_path(hw_vulkan_icd_dir), "*.json"))
+	for _, file := range files {
+		library := read_icd_library(file)
+		if library == "" {
+			continue
+		}
+
+		icd := Hw_vulkan_icd{File: file, Library: library,
+			Lib32: strings.HasSuffix(file, ".i686.json") || strings.Contains(library, "lib32")}
+
+		// Plain library names are resolved by the loader in the library directory of the architecture
+		if filepath.IsAbs(library) {
+			icd.Present = file_exists(hw_path(library))
+		} else if icd.Lib32 {
+			icd.Present = file_exists(hw_path(filepath.Join(hw_lib32_dir, library)))
+		} else {
+			icd.Present = file_exists(hw_path(filepath.Join(hw_lib_dir, library)))
+		}
+
+		icds = append(icds, icd)
+	}
+
+	return icds
+}
+
+// returns the library_path of a Vulkan ICD or GLVND EGL vendor file
+func read_icd_library(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+
+	var icd struct {
+		ICD struct {
+			Library_path string `json:"library_path"`
+		}
+	}
+	if json.Unmarshal(data, &icd) != nil {
+		return ""
+	}
+	return icd.ICD.Library_path
+}
+
+// returns the vendors of the GLVND libraries in the directory, like "mesa" for libGLX_mesa.so.0
+func get_glvnd_vendors(dir, api string) []string {
+	var vendors []string
+
+	files, _ := filepath.Glob(filepath.Join(hw_path(dir), "lib"+api+"_*.so.0"))
+	for _, file := range files {
+		if matches := hw_glvnd_vendor_regex.FindStringSubmatch(filepath.Base(file)); matches != nil {
+			vendors = append(vendors, matches[1])
+		}
+	}
+
+	return vendors
+}
+
+func get_egl_vendors() []string {
+	var vendors []string
+
+	files, _ := filepath.Glob(filepath.Join(hw_path(hw_egl_vendor_dir), "*.json"))
+	for _, file := range files {
+		if matches := hw_glvnd_vendor_regex.FindStringSubmatch(read_icd_library(file)); matches != nil {
+			vendors = append(vendors, matches[1])
+		}
+	}
+
+	return vendors
+}
+
+func get_xorg_files() []Hw_xorg_file {
+	var xorg_files []Hw_xorg_file
+
+	files, _ := filepath.Glob(filepath.Join(hw_path(hw_xorg_conf_dir), "*.conf"))
+	for _, path := range files {
+		file, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+
+		xorg := Hw_xorg_file{File: path, Mhwd: filepath.Base(path) == hw_mhwd_xorg_conf}
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line, _, _ := strings.Cut(scanner.Text(), "#")
+			if matches := hw_xorg_driver_regex.FindStringSubmatch(line); matches != nil &&
+				!slices.Contains(xorg.Drivers, matches[1]) {
+				xorg.Drivers = append(xorg.Drivers, matches[1])
+			}
+		}
+		file.Close()
+
+		xorg_files = append(xorg_files, xorg)
+	}
+
+	return xorg_files
+}
+
+func file_exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Time to wait for further uevents before rescanning, hotplugging a device usually emits a
+// burst of events for the device and its functions or interfaces.
+const hw_hotplug_debounce = 500 * time.Millisecond
+
+var hw_hotplug_mutex sync.Mutex
+var hw_hotplug_timer *time.Timer
+
+// Listens to kernel uevents and rescans devices when PCI or USB devices are added or removed.
+// Emits hwDeviceAdded and hwDeviceRemoved with the device for each change.
+func (mgr *Hw_manager) Start_hotplug_monitor() {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC,
+		syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		log.Println("error: failed to open uevent socket:", err)
+		return
+	}
+
+	// Group 1 receives the kernel events
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		log.Println("error: failed to bind uevent socket:", err)
+		syscall.Close(fd)
+		return
+	}
+
+	go func() {
+		defer syscall.Close(fd)
+
+		buf := make([]byte, 64*1024)
+		for {
+			n, _, err := syscall.Recvfrom(fd, buf, 0)
+			if err != nil {
+				if err == syscall.EINTR {
+					continue
+				}
+				log.Println("error: failed to receive uevent:", err)
+				return
+			}
+
+			if is_hotplug_uevent(parse_uevent(buf[:n])) {
+				schedule_device_rescan()
+			}
+		}
+	}()
+}
+
+// Parses a kernel uevent of the form "action@devpath\0KEY=value\0...".
+func parse_uevent(msg []byte) map[string]string {
+	env := make(map[string]string)
+
+	for _, field := range strings.Split(string(msg), "\x00") {
+		if key, value, found := strings.Cut(field, "="); found {
+			env[key] = value
+		}
+	}
+
+	return env
+}
+
+func is_hotplug_uevent(env map[string]string) bool {
+	if env["ACTION"] != "add" && env["ACTION"] != "remove" {
+		return false
+	}
+
+	switch env["SUBSYSTEM"] {
+	case "pci":
+		return true
+	case "usb":
+		// Ignore the interfaces of a device
+		return env["DEVTYPE"] == "usb_device"
+	}
+	return false
+}
+
+// Rescans once no further uevents arrived for the debounce time.
+func schedule_device_rescan() {
+	hw_hotplug_mutex.Lock()
+	defer hw_hotplug_mutex.Unlock()
+
+	if hw_hotplug_timer != nil {
+		hw_hotplug_timer.Stop()
+	}
+	hw_hotplug_timer = time.AfterFunc(hw_hotplug_debounce, rescan_devices)
+}
+
+func rescan_devices() {
+	Lock_hw_manager()
+	defer Unlock_hw_manager()
+
+	old_pci, old_usb := Hwmgr.Pci_devices, Hwmgr.Usb_devices
+
+	Fill_devices()
+	Update_configs()
+
+	emit_device_changes(old_pci, Hwmgr.Pci_devices)
+	emit_device_changes(old_usb, Hwmgr.Usb_devices)
+}
+
+func emit_device_changes(old_devices, new_devices []Hw_device) {
+	contains := func(devices []Hw_device, dev *Hw_device) bool {
+		for i := range devices {
+			if devices[i].Sysfs_bus_id == dev.Sysfs_bus_id && devices[i].Device_id == dev.Device_id {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := range new_devices {
+		if !contains(old_devices, &new_devices[i]) {
+			log.Println("device added:", new_devices[i].Sysfs_bus_id, new_devices[i].Model)
+			emit_hw_event("hwDeviceAdded", new_devices[i])
+		}
+	}
+
+	for i := range old_devices {
+		if !contains(new_devices, &old_devices[i]) {
+			log.Println("device removed:", old_devices[i].Sysfs_bus_id, old_devices[i].Model)
+			emit_hw_event("hwDeviceRemoved", old_devices[i])
+		}
+	}
+}
+
+func emit_hw_event(name string, data ...any) {
+	if Hwmgr.App != nil {
+		Hwmgr.App.EmitEvent(name, data...)
+	}
+}
@@ -0,0 +1,77 @@
+//go:build hwinfo
+
+package backend
+
+/*
+#cgo pkg-config: hwinfo
+#include "hwinfo-helpers.h"
+*/
+import "C"
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Enumerates devices through a full libhwinfo scan.
+type hwinfo_enumerator struct{}
+
+func init() {
+	hw_enumerator = hwinfo_enumerator{}
+}
+
+func from_hex(hexnum uint16, fill int) string {
+	return fmt.Sprintf("%0*x", fill, hexnum)
+}
+
+func from_char_array(c *C.char) string {
+	if c == nil {
+		return ""
+	}
+	return C.GoString(c)
+}
+
+func (hwinfo_enumerator) Devices(kind Hw_kind) []Hw_device {
+	var ckind C.hwtype
+	if kind == Usb_kind {
+		ckind = C.HWUSB
+	} else {
+		ckind = C.HWPCI
+	}
+
+	hw_list := C.hw_get_devices(ckind)
+
+	var devices []Hw_device
+
+	for hd := hw_list.first; hd != nil; hd = hd.next {
+		var dev Hw_device
+		dev.Kind = kind
+
+		dev.Class_id = from_hex(uint16(hd.base_class.id), 2) +
+			strings.ToLower(from_hex(uint16(hd.sub_class.id), 2))
+		dev.Vendor_id = strings.ToLower(from_hex(uint16(hd.vendor.id), 4))
+		dev.Subvendor_id = strings.ToLower(from_hex(uint16(hd.sub_vendor.id), 4))
+		dev.Device_id = strings.ToLower(from_hex(uint16(hd.device.id), 4))
+		dev.Subdevice_id = strings.ToLower(from_hex(uint16(hd.sub_device.id), 4))
+
+		dev.Model = from_char_array(hd.model)
+
+		dev.Class_name = from_char_array(hd.base_class.name)
+		dev.Subclass_name = from_char_array(hd.sub_class.name)
+		dev.Vendor_name = from_char_array(hd.vendor.name)
+		dev.Subvendor_name = from_char_array(hd.sub_vendor.name)
+		dev.Device_name = from_char_array(hd.device.name)
+		dev.Subdevice_name = from_char_array(hd.sub_device.name)
+		dev.Sysfs_bus_id = from_char_array(hd.sysfs_bus_id)
+		dev.Sysfs_id = from_char_array(hd.sysfs_id)
+		dev.Serial = from_char_array(hd.serial)
+
+		devices = append(devices, dev)
+	}
+
+	C.hd_free_hd_list(hw_list.first)
+	C.hd_free_hd_data(hw_list.data)
+	C.free(unsafe.Pointer(hw_list.data))
+
+	return devices
+}
@@ -0,0 +1,230 @@
+package backend
+
+import (
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const hw_prime_run_path = "/usr/bin/prime-run"
+const hw_xorg_conf_dir = "/etc/X11/xorg.conf.d"
+
+const hw_nvidia_vendor_id = "10de"
+const hw_intel_vendor_id = "8086"
+
+// File owned by the control panel, it is overwritten on each change. The module options are
+// part of the module policy.
+const hw_offload_env_path = "/etc/environment.d/90-mcp-prime-offload.conf"
+
+const hw_nvidia_pm_option = "NVreg_DynamicPowerManagement=0x02"
+
+const hw_owned_file_header = "# Written by Manjaro Control Panel, changes will be overwritten.\n"
+
+var hw_xorg_primary_gpu_regex = regexp.MustCompile(`(?i)Option\s+"PrimaryGPU"\s+"(yes|on|true|1)"`)
+
+// Render offload settings of hybrid graphics. Changes take effect after a reboot.
+type Hw_offload_settings struct {
+	// Render all applications on the discrete GPU instead of only those started with prime-run
+	Always_offload bool
+	// Let the NVIDIA driver power down the discrete GPU when idle (Turing and newer)
+	Dynamic_power_management bool
+}
+
+// Multi-GPU topology of the machine.
+type Hw_hybrid_graphics struct {
+	Hybrid bool
+	Gpus   []*Hw_device
+
+	// Sysfs bus IDs of the GPU initialized by the firmware and of the GPU used for offloading
+	Primary, Discrete string
+
+	// Matching and installed hybrid configs, sorted by priority
+	Configs, Installed_configs []*Hw_config
+
+	// One of "none", "integrated" (discrete GPU without driver), "on-demand" (prime-run),
+	// "always-offload" or "discrete" (discrete GPU drives the display)
+	Offload_mode string
+	Prime_run    bool
+	Settings     Hw_offload_settings
+}
+
+// returns the VGA, 3D and other display controllers
+func get_gpus() []*Hw_device {
+	var gpus []*Hw_device
+	for i := range Hwmgr.Pci_devices {
+		dev := &Hwmgr.Pci_devices[i]
+		if is_display_device(dev) {
+			gpus = append(gpus, dev)
+		}
+	}
+	return gpus
+}
+
+// returns whether display controllers of more than one vendor are present
+func is_hybrid_graphics() bool {
+	var vendors []string
+	for i := range Hwmgr.Pci_devices {
+		dev := &Hwmgr.Pci_devices[i]
+		if is_display_device(dev) && !slices.Contains(vendors, dev.Vendor_id) {
+			vendors = append(vendors, dev.Vendor_id)
+		}
+	}
+	return len(vendors) > 1
+}
+
+// returns the GPU used for offloading. The boot GPU is no hint, MUX laptops can boot on the
+// discrete GPU. NVIDIA GPUs are always discrete and Intel GPUs integrated, otherwise a 3D
+// controller is more likely discrete than a VGA controller.
+func get_discrete_gpu(gpus []*Hw_device) *Hw_device {
+	rank := func(gpu *Hw_device) int {
+		switch {
+		case gpu.Vendor_id == hw_nvidia_vendor_id:
+			return 3
+		case gpu.Class_id == "0302":
+			return 2
+		case gpu.Vendor_id != hw_intel_vendor_id:
+			return 1
+		}
+		return 0
+	}
+
+	var discrete *Hw_device
+	for _, gpu := range gpus {
+		if rank(gpu) > 0 && (discrete == nil || rank(gpu) > rank(discrete)) {
+			discrete = gpu
+		}
+	}
+	return discrete
+}
+
+func Get_hybrid_graphics() Hw_hybrid_graphics {
+	hybrid := Hw_hybrid_graphics{Gpus: get_gpus(), Offload_mode: "none", Hybrid: is_hybrid_graphics()}
+
+	for _, gpu := range hybrid.Gpus {
+		if gpu.Boot_vga {
+			hybrid.Primary = gpu.Sysfs_bus_id
+		}
+	}
+	discrete := get_discrete_gpu(hybrid.Gpus)
+	if !hybrid.Hybrid || discrete == nil {
+		return hybrid
+	}
+	hybrid.Discrete = discrete.Sysfs_bus_id
+
+	for _, gpu := range hybrid.Gpus {
+		for _, cfg := range gpu.Available_configs {
+			if is_hybrid_config(cfg) {
+				add_config_sorted(&hybrid.Configs, cfg)
+			}
+		}
+		for _, cfg := range gpu.Installed_configs {
+			if is_hybrid_config(cfg) {
+				add_config_sorted(&hybrid.Installed_configs, cfg)
+			}
+		}
+	}
+
+	_, err := os.Stat(hw_path(hw_prime_run_path))
+	hybrid.Prime_run = err == nil
+	hybrid.Settings = read_offload_settings()
+
+	switch {
+	case discrete.Driver == "":
+		hybrid.Offload_mode = "integrated"
+	case is_xorg_primary_gpu_set():
+		hybrid.Offload_mode = "discrete"
+	case hybrid.Settings.Always_offload:
+		hybrid.Offload_mode = "always-offload"
+	default:
+		hybrid.Offload_mode = "on-demand"
+	}
+
+	return hybrid
+}
+
+// Writes the offload settings into the files owned by the control panel.
+func Set_offload_settings(settings Hw_offload_settings) error {
+	hybrid := Get_hybrid_graphics()
+	if !hybrid.Hybrid || hybrid.Discrete == "" {
+		return errors.New("no hybrid graphics found")
+	}
+
+	var discrete *Hw_device
+	for _, gpu := range hybrid.Gpus {
+		if gpu.Sysfs_bus_id == hybrid.Discrete {
+			discrete = gpu
+		}
+	}
+
+	env := ""
+	if settings.Always_offload {
+		if discrete.Driver == "nvidia" {
+			env = "__NV_PRIME_RENDER_OFFLOAD=1\n__VK_LAYER_NV_optimus=NVIDIA_only\n__GLX_VENDOR_LIBRARY_NAME=nvidia\n"
+		} else {
+			env = "DRI_PRIME=1\n"
+		}
+	}
+	if err := write_owned_file(hw_path(hw_offload_env_path), env); err != nil {
+		return err
+	}
+
+	if settings.Dynamic_power_management == read_offload_settings().Dynamic_power_management {
+		return nil
+	}
+
+	// Keep the other options of the module
+	key, _, _ := strings.Cut(hw_nvidia_pm_option, "=")
+	var options []string
+	for _, option := range strings.Fields(read_module_policy().Options["nvidia"]) {
+		if !strings.HasPrefix(option, key+"=") {
+			options = append(options, option)
+		}
+	}
+	if settings.Dynamic_power_management {
+		options = append(options, hw_nvidia_pm_option)
+	}
+	return Set_module_options("nvidia", strings.Join(options, " "))
+}
+
+func read_offload_settings() Hw_offload_settings {
+	var settings Hw_offload_settings
+
+	if env, err := os.ReadFile(hw_path(hw_offload_env_path)); err == nil {
+		settings.Always_offload = strings.Contains(string(env), "__NV_PRIME_RENDER_OFFLOAD=1") ||
+			strings.Contains(string(env), "DRI_PRIME=1")
+	}
+	options := strings.Fields(read_module_policy().Options["nvidia"])
+	settings.Dynamic_power_management = slices.Contains(options, hw_nvidia_pm_option)
+
+	return settings
+}
+
+// returns whether an Xorg config makes a GPU other than the boot GPU drive the display
+func is_xorg_primary_gpu_set() bool {
+	files, _ := filepath.Glob(filepath.Join(hw_path(hw_xorg_conf_dir), "*.conf"))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil && hw_xorg_primary_gpu_regex.Match(data) {
+			return true
+		}
+	}
+	return false
+}
+
+// Writes the content with a header or removes the file if the content is empty.
+func write_owned_file(path, content string) error {
+	if content == "" {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+		log.Println("removing", path)
+		return remove_privileged(path)
+	}
+
+	log.Println("writing", path)
+	return write_privileged_file(path, []byte(hw_owned_file_header+content))
+}
@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const hw_pci_ids_path = "/usr/share/hwdata/pci.ids"
+const hw_usb_ids_path = "/usr/share/hwdata/usb.ids"
+
+// Names of the pci.ids or usb.ids database. All IDs are lower case hex strings.
+type Hw_ids_db struct {
+	Vendors    map[string]string // vendor id
+	Devices    map[string]string // vendor id + device id
+	Subsystems map[string]string // vendor id + device id + subvendor id + subdevice id
+	Classes    map[string]string // class id
+	Subclasses map[string]string // class id + subclass id
+}
+
+// Databases by path, each is only read once. Hotplug rescans read them concurrently.
+var hw_ids_dbs = map[string]*Hw_ids_db{}
+var hw_ids_dbs_mutex sync.Mutex
+
+func new_hw_ids_db() *Hw_ids_db {
+	return &Hw_ids_db{
+		Vendors:    map[string]string{},
+		Devices:    map[string]string{},
+		Subsystems: map[string]string{},
+		Classes:    map[string]string{},
+		Subclasses: map[string]string{},
+	}
+}
+
+// Parses a pci.ids or usb.ids file. Returns an empty database if the file can't be read.
+func load_ids_db(path string) *Hw_ids_db {
+	db := new_hw_ids_db()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return db
+	}
+	defer file.Close()
+
+	const (
+		section_skip = iota
+		section_vendor
+		section_class
+	)
+
+	section := section_skip
+	var parent, device string
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		id, name, found := strings.Cut(strings.TrimSpace(line), "  ")
+		if !found {
+			continue
+		}
+		id = strings.ToLower(id)
+		name = strings.TrimSpace(name)
+
+		switch {
+		case depth == 0 && strings.HasPrefix(id, "c "):
+			// Class section: "C 03  Display controller"
+			section = section_class
+			parent = strings.TrimSpace(id[2:])
+			db.Classes[parent] = name
+		case depth == 0 && len(id) == 4 && is_hex(id):
+			section = section_vendor
+			parent = id
+			db.Vendors[parent] = name
+		case depth == 0:
+			// Other sections like USB HID usages are not of interest
+			section = section_skip
+		case depth == 1 && section == section_vendor:
+			device = id
+			db.Devices[parent+device] = name
+		case depth == 2 && section == section_vendor && strings.Contains(id, " "):
+			// Subsystem of the device: "1043 15a0  GP107M [GeForce GTX 1050 Mobile]"
+			db.Subsystems[parent+device+strings.ReplaceAll(id, " ", "")] = name
+		case depth == 1 && section == section_class:
+			db.Subclasses[parent+id] = name
+		}
+	}
+
+	return db
+}
+
+// returns the database of the kind below the root, read on first use
+func get_ids_db(root string, kind Hw_kind) *Hw_ids_db {
+	path := filepath.Join(root, hw_pci_ids_path)
+	if kind == Usb_kind {
+		path = filepath.Join(root, hw_usb_ids_path)
+	}
+
+	hw_ids_dbs_mutex.Lock()
+	defer hw_ids_dbs_mutex.Unlock()
+
+	if db, found := hw_ids_dbs[path]; found {
+		return db
+	}
+	db := load_ids_db(path)
+	hw_ids_dbs[path] = db
+	return db
+}
+
+// Fills the names the enumerator left empty, like hwinfo does for devices newer than its
+// database or fixtures do that only record IDs.
+func fill_device_names(devices []Hw_device) {
+	for i := range devices {
+		get_ids_db(hw_root, devices[i].Kind).set_names(&devices[i])
+	}
+}
+
+// Sets the empty names of the device from the database.
+func (db *Hw_ids_db) set_names(dev *Hw_device) {
+	set := func(name *string, value string) {
+		if *name == "" {
+			*name = value
+		}
+	}
+
+	if len(dev.Class_id) == 4 {
+		set(&dev.Class_name, db.Classes[dev.Class_id[:2]])
+		set(&dev.Subclass_name, db.Subclasses[dev.Class_id])
+	}
+	set(&dev.Vendor_name, db.Vendors[dev.Vendor_id])
+	set(&dev.Device_name, db.Devices[dev.Vendor_id+dev.Device_id])
+	set(&dev.Subvendor_name, db.Vendors[dev.Subvendor_id])
+	set(&dev.Subdevice_name, db.Subsystems[dev.Vendor_id+dev.Device_id+dev.Subvendor_id+dev.Subdevice_id])
+	set(&dev.Model, strings.TrimSpace(dev.Vendor_name+" "+dev.Device_name))
+}
+
+func is_hex(str string) bool {
+	for _, c := range str {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return str != ""
+}
@@ -0,0 +1,117 @@
+package backend
+
+import "slices"
+
+// Keys of the ID lists in the order of hw_ids_index.
+var hw_ids_keys = [...]string{"CLASSIDS", "VENDORIDS", "DEVICEIDS", "SUBVENDORIDS", "SUBDEVICEIDS"}
+
+// Lookup set of the IDs of one key. Configs of proprietary drivers list thousands of device IDs,
+// scanning them for every device made matching slow.
+type hw_id_set struct {
+	any bool
+	ids map[string]struct{}
+}
+
+// ID sets of an ID group, built once when the config is read.
+type hw_ids_index struct {
+	hw, blacklist [len(hw_ids_keys)]hw_id_set
+}
+
+func new_hw_id_set(ids []string) hw_id_set {
+	set := hw_id_set{ids: make(map[string]struct{}, len(ids))}
+	for _, id := range ids {
+		if id == "*" {
+			set.any = true
+		}
+		set.ids[id] = struct{}{}
+	}
+	return set
+}
+
+// returns whether the ID is listed or "*" is
+func (set *hw_id_set) matches(id string) bool {
+	return set.any || set.lists(id)
+}
+
+// returns whether the ID itself is listed, as blacklists don't know wildcards
+func (set *hw_id_set) lists(id string) bool {
+	_, found := set.ids[id]
+	return found
+}
+
+func (ids *Hw_ids) lists() [len(hw_ids_keys)][]string {
+	return [...][]string{ids.Class_ids, ids.Vendor_ids, ids.Device_ids, ids.Subvendor_ids, ids.Subdevice_ids}
+}
+
+func new_hw_ids_index(ids *Hw_config_ids) *hw_ids_index {
+	var index hw_ids_index
+
+	hw, blacklist := ids.Hw.lists(), ids.Blacklist.lists()
+	for i := range hw_ids_keys {
+		index.hw[i] = new_hw_id_set(hw[i])
+		index.blacklist[i] = new_hw_id_set(blacklist[i])
+	}
+
+	return &index
+}
+
+// Indexes the ID groups of the config, the ID lists must not change afterwards.
+func index_config_ids(config *Hw_config) {
+	for i := range config.Hw {
+		config.Hw[i].index = new_hw_ids_index(&config.Hw[i])
+	}
+}
+
+func (device *Hw_device) ids() [len(hw_ids_keys)]string {
+	return [...]string{device.Class_id, device.Vendor_id, device.Device_id, device.Subvendor_id, device.Subdevice_id}
+}
+
+// Inverted index of the ID groups of a config list by vendor and device ID. Matching only checks
+// the groups listing the IDs of a device instead of every group of every config.
+type hw_config_index struct {
+	// Groups by "vendor:device", or "vendor:*" for groups matching any device of the vendor
+	groups map[string][]hw_group_ref
+	// Groups matching any vendor, candidates for every device
+	any_vendor []hw_group_ref
+}
+
+// ID group of a config, by position in the config list.
+type hw_group_ref struct {
+	config, group int
+}
+
+// Indexes the configs, the list must not change afterwards.
+func new_hw_config_index(configs []Hw_config) *hw_config_index {
+	index := hw_config_index{groups: map[string][]hw_group_ref{}}
+
+	for i := range configs {
+		for j := range configs[i].Hw {
+			ref := hw_group_ref{config: i, group: j}
+			ids := &configs[i].Hw[j].Hw
+
+			if slices.Contains(ids.Vendor_ids, "*") || len(ids.Vendor_ids) == 0 {
+				index.any_vendor = append(index.any_vendor, ref)
+				continue
+			}
+
+			devices := ids.Device_ids
+			if slices.Contains(devices, "*") || len(devices) == 0 {
+				devices = []string{"*"}
+			}
+			for _, vendor := range ids.Vendor_ids {
+				for _, device := range devices {
+					key := vendor + ":" + device
+					index.groups[key] = append(index.groups[key], ref)
+				}
+			}
+		}
+	}
+
+	return &index
+}
+
+// returns the groups that may match the device, the other IDs and blacklists are not checked
+func (index *hw_config_index) candidates(device *Hw_device) []hw_group_ref {
+	return slices.Concat(index.groups[device.Vendor_id+":"+device.Device_id],
+		index.groups[device.Vendor_id+":*"], index.any_vendor)
+}
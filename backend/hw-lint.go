@@ -0,0 +1,181 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Result of validating the config files below one or more directories.
+type Hw_lint_result struct {
+	Configs     int
+	Errors      int
+	Warnings    int
+	Diagnostics []Hw_config_diagnostic
+}
+
+// returns the default directories to lint, the pci and usb directories of all config roots
+func Get_lint_dirs() []string {
+	var dirs []string
+	for _, root := range Get_config_roots() {
+		dirs = append(dirs, filepath.Join(root, Pci_kind.String()), filepath.Join(root, Usb_kind.String()))
+	}
+	return dirs
+}
+
+// Validates all MHWDCONFIG files below the directories. Besides the problems found when reading
+// a config, it reports duplicate names within a directory and ID groups that can never match.
+// Configs in different directories may share a name, as configs in other roots are shadowed.
+func Lint_configs(dirs []string) Hw_lint_result {
+	result := Hw_lint_result{Diagnostics: []Hw_config_diagnostic{}}
+	var configs []Hw_config
+	var config_dirs []string
+
+	for _, dir := range dirs {
+		kind := Pci_kind
+		if strings.Contains(dir+"/", "/usb/") {
+			kind = Usb_kind
+		}
+
+		for _, path := range get_recursive_directory_file_list(dir, hw_mhwd_cfg_name) {
+			var cfg Hw_config
+			fill_config(&cfg, path, kind)
+			check_non_assignments(&cfg, path)
+			check_never_matching_groups(&cfg)
+			configs = append(configs, cfg)
+			config_dirs = append(config_dirs, dir)
+		}
+	}
+
+	check_duplicate_names(configs, config_dirs)
+
+	result.Configs = len(configs)
+	for _, cfg := range configs {
+		result.Diagnostics = append(result.Diagnostics, cfg.Diagnostics...)
+	}
+	for _, diag := range result.Diagnostics {
+		if diag.Error {
+			result.Errors++
+		} else {
+			result.Warnings++
+		}
+	}
+
+	return result
+}
+
+// Warns about lines outside of shell functions that are no assignments, like stray shell code.
+func check_non_assignments(config *Hw_config, config_path string) {
+	file, err := os.Open(config_path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var functions config_function_tracker
+	scanner := bufio.NewScanner(file)
+	line_nr := 0
+	for scanner.Scan() {
+		line_nr++
+
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		if line = strings.TrimSpace(line); line == "" {
+			continue
+		}
+		if !functions.in_function(line) && !strings.Contains(line, "=") {
+			add_config_warning(config, config_path, line_nr, "", "line is not an assignment: "+line)
+		}
+	}
+}
+
+// Reports ID groups where every listed ID of one type is also blacklisted.
+func check_never_matching_groups(config *Hw_config) {
+	blocked := func(ids, blacklist []string) bool {
+		if slices.Contains(ids, "*") {
+			return false
+		}
+		for _, id := range ids {
+			if !slices.Contains(blacklist, id) {
+				return false
+			}
+		}
+		return true
+	}
+
+	for i, ids := range config.Hw {
+		var keys []string
+		if blocked(ids.Hw.Class_ids, ids.Blacklist.Class_ids) {
+			keys = append(keys, "CLASSIDS")
+		}
+		if blocked(ids.Hw.Vendor_ids, ids.Blacklist.Vendor_ids) {
+			keys = append(keys, "VENDORIDS")
+		}
+		if blocked(ids.Hw.Device_ids, ids.Blacklist.Device_ids) {
+			keys = append(keys, "DEVICEIDS")
+		}
+		if blocked(ids.Hw.Subvendor_ids, ids.Blacklist.Subvendor_ids) {
+			keys = append(keys, "SUBVENDORIDS")
+		}
+		if blocked(ids.Hw.Subdevice_ids, ids.Blacklist.Subdevice_ids) {
+			keys = append(keys, "SUBDEVICEIDS")
+		}
+
+		if len(keys) != 0 {
+			add_config_error(config, config.Config_path, 0, "",
+				fmt.Sprintf("ID group %d can never match, all of its %s are blacklisted", i+1,
+					strings.Join(keys, " and ")))
+		}
+	}
+}
+
+func check_duplicate_names(configs []Hw_config, config_dirs []string) {
+	for i := range configs {
+		if configs[i].Name == "" {
+			continue
+		}
+		for j := range configs {
+			if i != j && configs[i].Name == configs[j].Name && config_dirs[i] == config_dirs[j] {
+				add_config_error(&configs[i], configs[i].Config_path, 0, "name",
+					"duplicate name '"+configs[i].Name+"', also used by "+configs[j].Config_path)
+			}
+		}
+	}
+}
+
+// returns the result in a human-readable form, one line per diagnostic
+func (result *Hw_lint_result) Text() string {
+	var text strings.Builder
+
+	for _, diag := range result.Diagnostics {
+		severity := "warning"
+		if diag.Error {
+			severity = "error"
+		}
+
+		location := diag.File
+		if diag.Line != 0 {
+			location += fmt.Sprintf(":%d", diag.Line)
+		}
+		if diag.Key != "" {
+			location += " (" + strings.ToUpper(diag.Key) + ")"
+		}
+
+		fmt.Fprintf(&text, "%s: %s: %s\n", location, severity, diag.Problem)
+	}
+
+	fmt.Fprintf(&text, "%d configs checked, %d errors, %d warnings\n", result.Configs, result.Errors,
+		result.Warnings)
+	return text.String()
+}
+
+func (result *Hw_lint_result) Json() string {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return "{}"
+	}
+	return string(data) + "\n"
+}
@@ -0,0 +1,110 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Config that would match a device with the queried IDs.
+type Hw_config_match struct {
+	Kind       Hw_kind
+	Config     string
+	Version    string
+	Freedriver bool
+	Priority   int
+
+	// Matching ID group, starting at 1, and the number of groups. Configs with several groups,
+	// like hybrid graphics configs, need a matching device for each group.
+	Group, Groups int
+	Description   string
+}
+
+// Finds the configs of both buses matching the IDs "vendor:device" or "vendor:device:class",
+// without the device being present. Without class, any class the ID group allows is assumed.
+func Find_configs_for_ids(query string) ([]Hw_config_match, error) {
+	parts := strings.Split(strings.ToLower(strings.TrimSpace(query)), ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid query '%s', expected vendor:device[:class]", query)
+	}
+	for _, id := range parts {
+		if len(id) != 4 || !is_hex(id) {
+			return nil, fmt.Errorf("invalid query '%s', '%s' is not a 4-digit hex ID", query, id)
+		}
+	}
+
+	dev := Hw_device{Vendor_id: parts[0], Device_id: parts[1]}
+	if len(parts) == 3 {
+		dev.Class_id = parts[2]
+	}
+
+	var matches []Hw_config_match
+	for _, kind := range []Hw_kind{Pci_kind, Usb_kind} {
+		dev.Kind = kind
+		configs := get_all_configs(kind)
+		for i := range *configs {
+			if match, found := match_config_ids(&(*configs)[i], dev); found {
+				matches = append(matches, match)
+			}
+		}
+	}
+
+	// Like the available configs of a device, highest priority first
+	slices.SortStableFunc(matches, func(a, b Hw_config_match) int {
+		return b.Priority - a.Priority
+	})
+	return matches, nil
+}
+
+// returns the first ID group of the config matching the device. Unknown IDs of the device are
+// replaced by the first ID the group allows.
+func match_config_ids(config *Hw_config, dev Hw_device) (Hw_config_match, bool) {
+	for i := range config.Hw {
+		ids := &config.Hw[i]
+
+		group_dev := dev
+		if group_dev.Class_id == "" {
+			group_dev.Class_id = get_allowed_id(ids.Hw.Class_ids, ids.Blacklist.Class_ids)
+		}
+		if group_dev.Subvendor_id == "" {
+			group_dev.Subvendor_id = get_allowed_id(ids.Hw.Subvendor_ids, ids.Blacklist.Subvendor_ids)
+		}
+		if group_dev.Subdevice_id == "" {
+			group_dev.Subdevice_id = get_allowed_id(ids.Hw.Subdevice_ids, ids.Blacklist.Subdevice_ids)
+		}
+
+		if matched, _ := match_ids(ids, &group_dev); !matched {
+			continue
+		}
+
+		class := dev.Class_id
+		if class == "" {
+			class = strings.Join(ids.Hw.Class_ids, " ")
+		}
+		if class == "*" {
+			class = "any"
+		}
+		description := fmt.Sprintf("matched ID group %d of %d (class %s, vendor %s, device %s)", i+1,
+			len(config.Hw), class, dev.Vendor_id, dev.Device_id)
+		if !slices.Contains(ids.Hw.Subvendor_ids, "*") || !slices.Contains(ids.Hw.Subdevice_ids, "*") {
+			description += ", only for the listed subsystem IDs"
+		}
+
+		return Hw_config_match{Kind: config.Kind, Config: config.Name, Version: config.Version,
+			Freedriver: config.Freedriver, Priority: config.Priority, Group: i + 1, Groups: len(config.Hw),
+			Description: description}, true
+	}
+
+	return Hw_config_match{}, false
+}
+
+// returns an ID the list allows and the blacklist doesn't exclude, a wildcard allows any
+func get_allowed_id(ids, blacklist []string) string {
+	for _, id := range ids {
+		if id != "*" && !slices.Contains(blacklist, id) {
+			return id
+		}
+	}
+	// Any ID that is not blacklisted, blacklists only hold 4-digit IDs
+	return "*"
+}
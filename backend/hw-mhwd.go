@@ -0,0 +1,309 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Root all mhwd database, script, package manager, sysfs and kernel module paths are resolved
+// against. Pointing it to a temporary directory allows running transactions without touching the
+// live system.
+var hw_root = hw_pm_root
+
+// Runs an external command of a mhwd transaction. Output is written to stdout if no writer is
+// given. Can be replaced to run transactions without calling pacman or the mhwd script. Commands
+// changing the system go through hw_run_privileged_cmd.
+var hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Env = append(os.Environ(), "LANG=C", "LC_MESSAGES=C")
+	cmd.Stdout = os.Stdout
+	if output != nil {
+		cmd.Stdout = output
+	}
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// returns the path below the configured root
+func hw_path(path string) string {
+	return filepath.Join(hw_root, path)
+}
+
+func get_all_configs(kind Hw_kind) *[]Hw_config {
+	if kind == Usb_kind {
+		return &Hwmgr.All_usb_configs
+	}
+	return &Hwmgr.All_pci_configs
+}
+
+func get_installed_configs(kind Hw_kind) *[]Hw_config {
+	if kind == Usb_kind {
+		return &Hwmgr.Installed_usb_configs
+	}
+	return &Hwmgr.Installed_pci_configs
+}
+
+func get_devices_of_kind(kind Hw_kind) *[]Hw_device {
+	if kind == Usb_kind {
+		return &Hwmgr.Usb_devices
+	}
+	return &Hwmgr.Pci_devices
+}
+
+func get_db_dir(kind Hw_kind) string {
+	if kind == Usb_kind {
+		return hw_path(hw_mhwd_usb_db_dir)
+	}
+	return hw_path(hw_mhwd_pci_db_dir)
+}
+
+func find_config(configs *[]Hw_config, name string) *Hw_config {
+	for i := range *configs {
+		if (*configs)[i].Name == name {
+			return &(*configs)[i]
+		}
+	}
+	return nil
+}
+
+// Installs the config and all of its missing dependencies. Fails if the config conflicts with
+// installed configs.
+func install_config(kind Hw_kind, name string) error {
+	plan := resolve_install(kind, name)
+	if len(plan.Conflicts) != 0 {
+		return errors.New(strings.Join(plan.Conflicts, "; "))
+	}
+	return execute_plan(&plan)
+}
+
+// Removes the installed config. Fails if other installed configs depend on it.
+func remove_config(kind Hw_kind, name string) error {
+	plan := resolve_remove(kind, name)
+	if len(plan.Conflicts) != 0 {
+		return errors.New(strings.Join(plan.Conflicts, "; "))
+	}
+	return execute_plan(&plan)
+}
+
+// Removes and installs the configs of the plan in order. Conflicts are expected to be resolved
+// by the removals. If a step fails, the previous installed configs are restored.
+func execute_plan(plan *Hw_plan) error {
+	if len(plan.Errors) != 0 {
+		return errors.New(strings.Join(plan.Errors, "; "))
+	}
+
+	return with_rollback(plan.Kind, nil, plan.Install, func() error {
+		return execute_plan_steps(plan)
+	})
+}
+
+func execute_plan_steps(plan *Hw_plan) error {
+	for _, name := range plan.Remove {
+		config := find_config(get_installed_configs(plan.Kind), name)
+		if config == nil {
+			continue
+		}
+		if err := remove_single_config(config); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range plan.Install {
+		config := find_config(get_all_configs(plan.Kind), name)
+		if config == nil {
+			return fmt.Errorf("config '%s' does not exist", name)
+		}
+		if err := install_single_config(config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func install_single_config(config *Hw_config) error {
+	fmt.Println("> Installing", config.Name, config.Version+"...")
+
+	// The script installs the packages of the config before calling its post_install
+	if err := run_mhwd_script(config, true); err != nil {
+		return fmt.Errorf("install of config '%s' failed: %w", config.Name, err)
+	}
+
+	// Only sync the package database once per session
+	hw_sync_pm_db = false
+
+	target := filepath.Join(get_db_dir(config.Kind), config.Name)
+	if err := copy_privileged_directory(config.Base_path, target); err != nil {
+		return fmt.Errorf("failed to copy config '%s' to the database: %w", config.Name, err)
+	}
+
+	update_installed_configs()
+	fmt.Println("> Successfully installed", config.Name)
+	return nil
+}
+
+func remove_single_config(config *Hw_config) error {
+	fmt.Println("> Removing", config.Name, config.Version+"...")
+
+	if err := run_mhwd_script(config, false); err != nil {
+		return fmt.Errorf("post remove of config '%s' failed: %w", config.Name, err)
+	}
+
+	if pkgs, err := get_exclusive_packages(config); err != nil {
+		return err
+	} else if len(pkgs) != 0 {
+		args := append(get_pm_args(), "-Rns")
+		if err := hw_run_privileged_cmd(nil, "pacman", append(args, pkgs...)...); err != nil {
+			return fmt.Errorf("failed to remove packages of config '%s': %w", config.Name, err)
+		}
+	}
+
+	if err := remove_privileged(config.Base_path); err != nil {
+		return fmt.Errorf("failed to remove config '%s' from the database: %w", config.Name, err)
+	}
+
+	update_installed_configs()
+	fmt.Println("> Successfully removed", config.Name)
+	return nil
+}
+
+// returns the packages of the config for the running architecture
+func get_config_packages(config *Hw_config) []string {
+	pkgs := slices.Clone(config.Packages)
+	if runtime.GOARCH == "amd64" {
+		pkgs = append(pkgs, config.Packages_64...)
+	}
+	return pkgs
+}
+
+// returns the installed packages of the config that no other installed config needs
+func get_exclusive_packages(config *Hw_config) ([]string, error) {
+	installed, err := get_pm_installed_packages()
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []string
+	for _, pkg := range get_config_packages(config) {
+		if !slices.Contains(installed, pkg) {
+			continue
+		}
+
+		needed := false
+		for _, configs := range []*[]Hw_config{&Hwmgr.Installed_pci_configs, &Hwmgr.Installed_usb_configs} {
+			for i := range *configs {
+				other := &(*configs)[i]
+				if other.Name != config.Name && slices.Contains(get_config_packages(other), pkg) {
+					needed = true
+				}
+			}
+		}
+		if !needed {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	return pkgs, nil
+}
+
+func get_pm_args() []string {
+	return []string{"--noconfirm", "--noprogressbar",
+		"--cachedir", hw_path(hw_pm_cache_dir),
+		"--config", hw_path(hw_pm_config),
+		"--root", hw_root}
+}
+
+// Runs the mhwd script, which sources the config and calls its post_install or post_remove.
+func run_mhwd_script(config *Hw_config, install bool) error {
+	script := hw_path(hw_mhwd_script_path)
+	if _, err := os.Stat(script); err != nil {
+		return errors.New("mhwd script not found: " + script)
+	}
+
+	op := "--install"
+	if !install {
+		op = "--remove"
+	}
+
+	args := []string{op}
+	if install && hw_sync_pm_db {
+		args = append(args, "--sync")
+	}
+	args = append(args,
+		"--cachedir", hw_path(hw_pm_cache_dir),
+		"--pmconfig", hw_path(hw_pm_config),
+		"--pmroot", hw_root,
+		"--config", config.Config_path)
+
+	// Pass all devices matched by the config
+	for _, dev := range get_devices_of_config(get_devices_of_kind(config.Kind), config) {
+		args = append(args, "--device",
+			dev.Class_id+"|"+dev.Vendor_id+"|"+dev.Device_id+"|"+get_xorg_bus_id(dev.Sysfs_bus_id))
+	}
+
+	return hw_run_privileged_cmd(nil, script, args...)
+}
+
+// returns the bus id in the decimal "bus:device:function" form of the Xorg BusID option, "1:0:0"
+// for "0000:01:00.0". Bus ids of another form are returned unchanged.
+func get_xorg_bus_id(sysfs_bus_id string) string {
+	parts := strings.Split(strings.ReplaceAll(sysfs_bus_id, ".", ":"), ":")
+	if len(parts) < 3 {
+		return sysfs_bus_id
+	}
+
+	var numbers []string
+	for _, part := range parts[len(parts)-3:] {
+		number, err := strconv.ParseUint(part, 16, 32)
+		if err != nil {
+			return sysfs_bus_id
+		}
+		numbers = append(numbers, strconv.FormatUint(number, 10))
+	}
+	return strings.Join(numbers, ":")
+}
+
+// Recursively copies the directory as the current user, replacing an existing target.
+func copy_directory(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(src, func(path string, entry os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
@@ -0,0 +1,334 @@
+package backend
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// File owned by the control panel, overwritten on each change of the module policy.
+const hw_module_policy_path = "/etc/modprobe.d/90-mcp-modules.conf"
+const hw_proc_modules_path = "/proc/modules"
+const hw_initramfs_glob = "/boot/initramfs-*.img"
+
+// Directories read by modprobe, in order of precedence.
+var hw_modprobe_dirs = []string{"/etc/modprobe.d", "/run/modprobe.d", "/usr/lib/modprobe.d"}
+
+var hw_module_name_regex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Set once the policy changed in this session, the file might be removed since then.
+var hw_initramfs_stale = false
+
+// Blacklisted modules and module options set by the control panel.
+type Hw_module_policy struct {
+	Blacklist []string
+	// Options by module, like "NVreg_PreserveVideoMemoryAllocations=1"
+	Options map[string]string
+}
+
+// Modules supporting a device and which of them are loaded.
+type Hw_device_modules struct {
+	Sysfs_bus_id string
+	Model        string
+	Driver       string
+	Modules      []string
+	Loaded       []string
+}
+
+// Entry of another modprobe.d file working against the policy or a device module.
+type Hw_modprobe_conflict struct {
+	File    string
+	Line    int
+	Entry   string
+	Problem string
+}
+
+type Hw_module_status struct {
+	Policy    Hw_module_policy
+	Devices   []Hw_device_modules
+	Conflicts []Hw_modprobe_conflict
+	// The initramfs images are older than the policy, modules loaded early still use the old one
+	Initramfs_rebuild bool
+}
+
+// "blacklist", "options" or "install" entry of a modprobe.d file.
+type modprobe_entry struct {
+	file    string
+	line    int
+	command string
+	module  string
+	args    string
+}
+
+func Get_module_status() Hw_module_status {
+	status := Hw_module_status{Policy: read_module_policy(), Initramfs_rebuild: is_initramfs_rebuild_needed()}
+
+	loaded := get_loaded_modules()
+	for _, devices := range [][]Hw_device{Hwmgr.Pci_devices, Hwmgr.Usb_devices} {
+		for _, dev := range devices {
+			modules := get_device_modules(&dev)
+			if len(modules) == 0 {
+				continue
+			}
+
+			dev_modules := Hw_device_modules{Sysfs_bus_id: dev.Sysfs_bus_id, Model: dev.Model,
+				Driver: dev.Driver, Modules: modules}
+			for _, module := range modules {
+				if slices.Contains(loaded, module) {
+					dev_modules.Loaded = append(dev_modules.Loaded, module)
+				}
+			}
+			status.Devices = append(status.Devices, dev_modules)
+		}
+	}
+
+	status.Conflicts = get_modprobe_conflicts(&status.Policy, status.Devices)
+	return status
+}
+
+// Blacklists the module or removes it from the blacklist of the policy.
+func Set_module_blacklisted(module string, blacklisted bool) error {
+	if !hw_module_name_regex.MatchString(module) {
+		return fmt.Errorf("invalid module name '%s'", module)
+	}
+	module = normalize_module_name(module)
+
+	policy := read_module_policy()
+	policy.Blacklist = slices.DeleteFunc(policy.Blacklist, func(name string) bool { return name == module })
+	if blacklisted {
+		policy.Blacklist = append(policy.Blacklist, module)
+	}
+	return write_module_policy(&policy)
+}
+
+// Sets the options of the module, empty options remove them.
+func Set_module_options(module, options string) error {
+	if !hw_module_name_regex.MatchString(module) {
+		return fmt.Errorf("invalid module name '%s'", module)
+	}
+	if strings.ContainsAny(options, "\n#") {
+		return errors.New("module options must be a single line without comments")
+	}
+	module = normalize_module_name(module)
+
+	policy := read_module_policy()
+	if options = strings.TrimSpace(options); options == "" {
+		delete(policy.Options, module)
+	} else {
+		policy.Options[module] = options
+	}
+	return write_module_policy(&policy)
+}
+
+// Rebuilds the initramfs images of all installed kernels.
+func Rebuild_initramfs() error {
+	if err := hw_run_privileged_cmd(nil, "mkinitcpio", "-P"); err != nil {
+		return fmt.Errorf("failed to rebuild the initramfs: %w", err)
+	}
+	hw_initramfs_stale = false
+	return nil
+}
+
+func read_module_policy() Hw_module_policy {
+	policy := Hw_module_policy{Options: map[string]string{}}
+
+	for _, entry := range read_modprobe_file(hw_path(hw_module_policy_path)) {
+		switch entry.command {
+		case "blacklist":
+			policy.Blacklist = append(policy.Blacklist, entry.module)
+		case "options":
+			policy.Options[entry.module] = entry.args
+		}
+	}
+
+	return policy
+}
+
+func write_module_policy(policy *Hw_module_policy) error {
+	var content strings.Builder
+
+	slices.Sort(policy.Blacklist)
+	for _, module := range slices.Compact(policy.Blacklist) {
+		fmt.Fprintf(&content, "blacklist %s\n", module)
+	}
+
+	modules := make([]string, 0, len(policy.Options))
+	for module := range policy.Options {
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+	for _, module := range modules {
+		fmt.Fprintf(&content, "options %s %s\n", module, policy.Options[module])
+	}
+
+	if err := write_owned_file(hw_path(hw_module_policy_path), content.String()); err != nil {
+		return err
+	}
+	hw_initramfs_stale = true
+	return nil
+}
+
+// Parses the entries of a modprobe.d file, module names are normalized to underscores.
+func read_modprobe_file(path string) []modprobe_entry {
+	var entries []modprobe_entry
+
+	file, err := os.Open(path)
+	if err != nil {
+		return entries
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	line_nr := 0
+	for scanner.Scan() {
+		line_nr++
+
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+
+		command := strings.ToLower(fields[0])
+		if command != "blacklist" && command != "options" && command != "install" {
+			continue
+		}
+
+		entries = append(entries, modprobe_entry{file: path, line: line_nr, command: command,
+			module: normalize_module_name(fields[1]), args: strings.Join(fields[2:], " ")})
+	}
+
+	return entries
+}
+
+// returns the entries of all modprobe.d files except the policy. Like modprobe, a file in a
+// directory of higher precedence hides files with the same name.
+func read_other_modprobe_files() []modprobe_entry {
+	var entries []modprobe_entry
+	var seen []string
+
+	for _, dir := range hw_modprobe_dirs {
+		files, _ := filepath.Glob(filepath.Join(hw_path(dir), "*.conf"))
+		for _, file := range files {
+			name := filepath.Base(file)
+			if slices.Contains(seen, name) {
+				continue
+			}
+			seen = append(seen, name)
+
+			if dir+"/"+name == hw_module_policy_path {
+				continue
+			}
+			entries = append(entries, read_modprobe_file(file)...)
+		}
+	}
+
+	return entries
+}
+
+func get_modprobe_conflicts(policy *Hw_module_policy, devices []Hw_device_modules) []Hw_modprobe_conflict {
+	var conflicts []Hw_modprobe_conflict
+
+	add := func(entry *modprobe_entry, problem string) {
+		conflicts = append(conflicts, Hw_modprobe_conflict{File: entry.file, Line: entry.line,
+			Entry: strings.TrimSpace(entry.command + " " + entry.module + " " + entry.args), Problem: problem})
+	}
+
+	for _, entry := range read_other_modprobe_files() {
+		disables := entry.command == "blacklist" ||
+			(entry.command == "install" && slices.Contains([]string{"/bin/true", "/bin/false",
+				"/usr/bin/true", "/usr/bin/false"}, entry.args))
+
+		switch {
+		case disables && policy.Options[entry.module] != "":
+			add(&entry, "options are set for "+entry.module+", but it is disabled here")
+		case disables && !slices.Contains(policy.Blacklist, entry.module):
+			for _, dev := range devices {
+				if slices.Contains(dev.Modules, entry.module) {
+					add(&entry, entry.module+" supports "+or_none(dev.Model)+" ("+dev.Sysfs_bus_id+
+						"), but is disabled here")
+					break
+				}
+			}
+		case entry.command == "options" && policy.Options[entry.module] != "":
+			for _, key := range get_option_keys(entry.args) {
+				if slices.Contains(get_option_keys(policy.Options[entry.module]), key) {
+					add(&entry, "option "+key+" of "+entry.module+" is also set by the control panel")
+				}
+			}
+		}
+	}
+
+	return conflicts
+}
+
+// returns the parameter names of module options like "modeset=1 NVreg_X=0"
+func get_option_keys(options string) []string {
+	var keys []string
+	for _, option := range strings.Fields(options) {
+		key, _, _ := strings.Cut(option, "=")
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// returns the modules of the device, the module of the bound driver first
+func get_device_modules(dev *Hw_device) []string {
+	var modules []string
+	if dev.Driver != "" && dev.Sysfs_id != "" {
+		dir := hw_path(filepath.Join(hw_sysfs_dir, dev.Sysfs_id))
+		modules = append(modules, normalize_module_name(get_driver_module(dir, dev.Driver)))
+	}
+	for _, module := range dev.Modules {
+		if module = normalize_module_name(module); !slices.Contains(modules, module) {
+			modules = append(modules, module)
+		}
+	}
+	return modules
+}
+
+func get_loaded_modules() []string {
+	var modules []string
+
+	data, err := os.ReadFile(hw_path(hw_proc_modules_path))
+	if err != nil {
+		return modules
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, _, found := strings.Cut(line, " "); found {
+			modules = append(modules, name)
+		}
+	}
+
+	return modules
+}
+
+// returns whether the policy changed after the oldest initramfs image was built
+func is_initramfs_rebuild_needed() bool {
+	if hw_initramfs_stale {
+		return true
+	}
+
+	policy, err := os.Stat(hw_path(hw_module_policy_path))
+	if err != nil {
+		return false
+	}
+
+	images, _ := filepath.Glob(hw_path(hw_initramfs_glob))
+	for _, image := range images {
+		if info, err := os.Stat(image); err == nil && info.ModTime().Before(policy.ModTime()) {
+			return true
+		}
+	}
+	return false
+}
+
+// Module names are equal with dashes and underscores, the kernel uses underscores.
+func normalize_module_name(name string) string {
+	return strings.ReplaceAll(name, "-", "_")
+}
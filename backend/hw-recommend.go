@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Proprietary NVIDIA configs need the kernel module package of their driver branch for the
+// running kernel, like linux66-nvidia or linux66-nvidia-470xx.
+var hw_kernel_module_config_regex = regexp.MustCompile(`^video-(nvidia(-[0-9]+xx)?)$`)
+
+// Recommended config of a device, with the reasons that lead to the choice. Config is empty if no
+// available config is suitable.
+type Hw_recommendation struct {
+	Kind         Hw_kind
+	Sysfs_bus_id string
+	Model        string
+	Config       string
+	Reasons      []string
+}
+
+type recommend_context struct {
+	kind      Hw_kind
+	free_only bool
+	hybrid    bool
+	kernels   recommend_kernels
+}
+
+// Running kernel and the kernel packages, NVIDIA configs need the module package of the kernel.
+type recommend_kernels struct {
+	// Package name of the running kernel and all available kernel packages, empty if unknown
+	running  string
+	packages map[string]string
+}
+
+// Picks the best config for each device that has configs available or excluded by blacklists.
+func Recommend_configs(kind Hw_kind, free_only bool) []Hw_recommendation {
+	ctx := new_recommend_context(kind, free_only, get_recommend_kernels())
+
+	var recommendations []Hw_recommendation
+
+	devices := get_devices_of_kind(kind)
+	for i := range *devices {
+		rec := ctx.recommend(&(*devices)[i])
+		if rec.Config != "" || len(rec.Reasons) != 0 {
+			recommendations = append(recommendations, rec)
+		}
+	}
+
+	return recommendations
+}
+
+func new_recommend_context(kind Hw_kind, free_only bool, kernels recommend_kernels) *recommend_context {
+	return &recommend_context{kind: kind, free_only: free_only, hybrid: is_hybrid_graphics(), kernels: kernels}
+}
+
+// returns the running kernel and the available kernel packages, read through pacman
+func get_recommend_kernels() recommend_kernels {
+	var kernels recommend_kernels
+
+	for _, kernel := range Krlmgr.Get_kernels() {
+		if kernel.Running {
+			kernels.running = kernel.Name
+		}
+	}
+	if kernels.running != "" {
+		kernels.packages = get_available_packages()
+	} else {
+		log.Println("warning: running kernel unknown, kernel modules are not considered")
+	}
+
+	return kernels
+}
+
+func (ctx *recommend_context) recommend(dev *Hw_device) Hw_recommendation {
+	rec := Hw_recommendation{Kind: dev.Kind, Sysfs_bus_id: dev.Sysfs_bus_id, Model: dev.Model}
+
+	// With hybrid graphics a suitable hybrid config is preferred over single GPU configs
+	prefer_hybrid := ctx.hybrid && is_display_device(dev) &&
+		slices.ContainsFunc(dev.Available_configs, func(cfg *Hw_config) bool {
+			return is_hybrid_config(cfg) && ctx.skip_reason(cfg, false) == ""
+		})
+
+	// Available configs are sorted by priority, the first suitable one wins
+	for _, cfg := range dev.Available_configs {
+		if reason := ctx.skip_reason(cfg, prefer_hybrid); reason != "" {
+			rec.Reasons = append(rec.Reasons,
+				fmt.Sprintf("skipped %s (priority %d): %s", cfg.Name, cfg.Priority, reason))
+			continue
+		}
+
+		rec.Config = cfg.Name
+
+		driver := "proprietary"
+		if cfg.Freedriver {
+			driver = "open-source"
+		}
+		rec.Reasons = append(rec.Reasons, fmt.Sprintf("chose %s (priority %d, %s driver): %s", cfg.Name,
+			cfg.Priority, driver, describe_matched_group(cfg, dev)))
+
+		if slices.ContainsFunc(dev.Installed_configs, func(installed *Hw_config) bool {
+			return installed.Name == cfg.Name
+		}) {
+			rec.Reasons = append(rec.Reasons, cfg.Name+" is already installed")
+		} else if conflicts := get_installed_conflicts(ctx.kind, cfg); len(conflicts) != 0 {
+			rec.Reasons = append(rec.Reasons, cfg.Name+" replaces installed "+strings.Join(conflicts, ", "))
+		}
+		break
+	}
+
+	if rec.Config == "" && len(dev.Available_configs) != 0 {
+		rec.Reasons = append(rec.Reasons, "no available config is suitable")
+	}
+
+	rec.Reasons = append(rec.Reasons, get_blacklist_exclusions(ctx.kind, dev)...)
+	return rec
+}
+
+// returns why the config is not suitable, or an empty string if it is
+func (ctx *recommend_context) skip_reason(config *Hw_config, prefer_hybrid bool) string {
+	if ctx.free_only && !config.Freedriver {
+		return "proprietary driver, but only open-source drivers are requested"
+	}
+
+	if prefer_hybrid && !is_hybrid_config(config) {
+		return "hybrid graphics detected, a hybrid config is preferred"
+	}
+
+	if find_config(get_installed_configs(ctx.kind), config.Name) == nil {
+		if plan := resolve_install(ctx.kind, config.Name); len(plan.Errors) != 0 {
+			return strings.Join(plan.Errors, "; ")
+		}
+	}
+
+	// Check the config and its dependencies for kernel modules
+	names := append([]string{config.Name}, config.Dependencies...)
+	for _, name := range names {
+		if reason := ctx.kernel_module_reason(name); reason != "" {
+			return reason
+		}
+	}
+
+	return ""
+}
+
+func (ctx *recommend_context) kernel_module_reason(config_name string) string {
+	matches := hw_kernel_module_config_regex.FindStringSubmatch(config_name)
+	if matches == nil || ctx.kernels.packages == nil {
+		return ""
+	}
+
+	pkg := ctx.kernels.running + "-" + matches[1]
+	if _, found := ctx.kernels.packages[pkg]; !found {
+		return "no " + pkg + " package for the running kernel " + ctx.kernels.running
+	}
+	return ""
+}
+
+// returns which ID group of the config matched the device and with which IDs
+func describe_matched_group(config *Hw_config, dev *Hw_device) string {
+	for i := range config.Hw {
+		if matched, _ := match_ids(&config.Hw[i], dev); !matched {
+			continue
+		}
+
+		describe := func(ids []string, value string) string {
+			if slices.Contains(ids, "*") {
+				return "any"
+			}
+			return value
+		}
+
+		ids := &config.Hw[i].Hw
+		group := fmt.Sprintf("matched ID group %d (class %s, vendor %s, device %s", i+1,
+			describe(ids.Class_ids, dev.Class_id), describe(ids.Vendor_ids, dev.Vendor_id),
+			describe(ids.Device_ids, dev.Device_id))
+
+		// Subsystem IDs are only of interest for the few configs restricting them
+		if !slices.Contains(ids.Subvendor_ids, "*") || !slices.Contains(ids.Subdevice_ids, "*") {
+			group += fmt.Sprintf(", subsystem %s:%s", describe(ids.Subvendor_ids, dev.Subvendor_id),
+				describe(ids.Subdevice_ids, dev.Subdevice_id))
+		}
+		return group + ")"
+	}
+	return "matched"
+}
+
+// returns which configs only don't match the device because of their blacklists
+func get_blacklist_exclusions(kind Hw_kind, dev *Hw_device) []string {
+	var exclusions []string
+
+	configs := get_all_configs(kind)
+	for i := range *configs {
+		cfg := &(*configs)[i]
+		if slices.ContainsFunc(dev.Available_configs, func(available *Hw_config) bool {
+			return available.Name == cfg.Name
+		}) {
+			continue
+		}
+
+		for j := range cfg.Hw {
+			matched, reason := match_ids(&cfg.Hw[j], dev)
+			if !matched && strings.Contains(reason, "BLACKLISTED") {
+				exclusions = append(exclusions,
+					fmt.Sprintf("excluded %s: %s of ID group %d", cfg.Name, reason, j+1))
+			}
+		}
+	}
+
+	return exclusions
+}
+
+// returns whether the device is a GPU: a VGA (0300), 3D (0302) or other display controller
+// (0380), as AMD GPUs without display outputs report
+func is_display_device(dev *Hw_device) bool {
+	return dev.Kind == Pci_kind && slices.Contains([]string{"0300", "0302", "0380"}, dev.Class_id)
+}
+
+func is_hybrid_config(config *Hw_config) bool {
+	return strings.Contains(config.Name, "hybrid")
+}
@@ -0,0 +1,200 @@
+package backend
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Result of resolving an install or remove request against the installed configs.
+type Hw_plan struct {
+	Kind Hw_kind
+	Name string
+
+	// Installed configs to remove, then configs to install, each in execution order
+	Remove, Install []string
+
+	// Why the request is blocked unless the additional removals are done
+	Conflicts []string
+	// Why the request can't be executed at all
+	Errors []string
+}
+
+// Resolves the configs to install for the config together with its missing dependencies. If
+// installed configs conflict, the plan replaces them.
+func resolve_install(kind Hw_kind, name string) Hw_plan {
+	plan := Hw_plan{Kind: kind, Name: name}
+
+	config := find_config(get_all_configs(kind), name)
+	if config == nil {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("config '%s' does not exist", name))
+		return plan
+	}
+	if find_config(get_installed_configs(kind), name) != nil {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("config '%s' is already installed", name))
+		return plan
+	}
+
+	var configs []*Hw_config
+	if err := add_dependencies_to_install(kind, config, &configs, nil, nil); err != nil {
+		plan.Errors = append(plan.Errors, err.Error())
+		return plan
+	}
+
+	// Installed conflicting configs are replaced, which also removes configs depending on them
+	for _, cfg := range configs {
+		for _, conflict := range get_installed_conflicts(kind, cfg) {
+			plan.Conflicts = append(plan.Conflicts, cfg.Name+" conflicts with installed "+conflict)
+			if err := add_requirements_to_remove(kind, conflict, &plan.Remove, nil); err != nil {
+				plan.Errors = append(plan.Errors, err.Error())
+				return plan
+			}
+		}
+	}
+
+	// Removals might include dependencies, which need to be installed again then
+	if len(plan.Remove) != 0 {
+		configs = nil
+		if err := add_dependencies_to_install(kind, config, &configs, plan.Remove, nil); err != nil {
+			plan.Errors = append(plan.Errors, err.Error())
+			return plan
+		}
+	}
+
+	for i, cfg := range configs {
+		for _, other := range configs[i+1:] {
+			if configs_conflict(cfg, other) {
+				plan.Errors = append(plan.Errors, cfg.Name+" conflicts with "+other.Name)
+			}
+		}
+		plan.Install = append(plan.Install, cfg.Name)
+	}
+
+	return plan
+}
+
+// Resolves the configs to remove for the installed config. Installed configs depending on it
+// have to be removed first.
+func resolve_remove(kind Hw_kind, name string) Hw_plan {
+	plan := Hw_plan{Kind: kind, Name: name}
+
+	if find_config(get_installed_configs(kind), name) == nil {
+		plan.Errors = append(plan.Errors, fmt.Sprintf("config '%s' is not installed", name))
+		return plan
+	}
+
+	if err := add_requirements_to_remove(kind, name, &plan.Remove, nil); err != nil {
+		plan.Errors = append(plan.Errors, err.Error())
+		return plan
+	}
+
+	for _, removed := range plan.Remove {
+		config := find_config(get_installed_configs(kind), removed)
+		for _, requirement := range get_installed_requirements(kind, config) {
+			plan.Conflicts = append(plan.Conflicts, removed+" is required by installed "+requirement)
+		}
+	}
+
+	return plan
+}
+
+// Appends the dependencies of the config that are not installed yet, followed by the config
+// itself, in the order they have to be installed. Installed configs in removed are treated as
+// not installed. Visiting holds the configs being resolved, to fail on cyclic dependencies.
+func add_dependencies_to_install(kind Hw_kind, config *Hw_config, configs *[]*Hw_config,
+	removed []string, visiting []string) error {
+	if err := check_cycle("dependency", visiting, config.Name); err != nil {
+		return err
+	}
+	visiting = append(visiting, config.Name)
+
+	for _, dep_name := range config.Dependencies {
+		if find_config(get_installed_configs(kind), dep_name) != nil && !slices.Contains(removed, dep_name) {
+			continue
+		}
+		if slices.ContainsFunc(*configs, func(cfg *Hw_config) bool { return cfg.Name == dep_name }) {
+			continue
+		}
+
+		dep := find_config(get_all_configs(kind), dep_name)
+		if dep == nil {
+			return fmt.Errorf("dependency '%s' of config '%s' does not exist", dep_name, config.Name)
+		}
+		if err := add_dependencies_to_install(kind, dep, configs, removed, visiting); err != nil {
+			return err
+		}
+	}
+
+	if !slices.Contains(*configs, config) {
+		*configs = append(*configs, config)
+	}
+	return nil
+}
+
+// Appends the installed configs depending on the config, followed by the config itself, in the
+// order they have to be removed. Visiting holds the configs being resolved, to fail on installed
+// configs that depend on each other.
+func add_requirements_to_remove(kind Hw_kind, name string, removals *[]string, visiting []string) error {
+	if slices.Contains(*removals, name) {
+		return nil
+	}
+	if err := check_cycle("requirement", visiting, name); err != nil {
+		return err
+	}
+	visiting = append(visiting, name)
+
+	config := find_config(get_installed_configs(kind), name)
+	if config == nil {
+		return nil
+	}
+
+	for _, requirement := range get_installed_requirements(kind, config) {
+		if err := add_requirements_to_remove(kind, requirement, removals, visiting); err != nil {
+			return err
+		}
+	}
+
+	*removals = append(*removals, name)
+	return nil
+}
+
+// returns an error if the config is already being resolved, "dependency cycle a -> b -> a"
+func check_cycle(relation string, visiting []string, name string) error {
+	i := slices.Index(visiting, name)
+	if i < 0 {
+		return nil
+	}
+	cycle := append(slices.Clone(visiting[i:]), name)
+	return fmt.Errorf("%s cycle %s", relation, strings.Join(cycle, " -> "))
+}
+
+func configs_conflict(config, other *Hw_config) bool {
+	return slices.Contains(config.Conflicts, other.Name) || slices.Contains(other.Conflicts, config.Name)
+}
+
+// returns the names of installed configs that conflict with the config
+func get_installed_conflicts(kind Hw_kind, config *Hw_config) []string {
+	var conflicts []string
+
+	installed := get_installed_configs(kind)
+	for i := range *installed {
+		if configs_conflict(config, &(*installed)[i]) {
+			conflicts = append(conflicts, (*installed)[i].Name)
+		}
+	}
+
+	return conflicts
+}
+
+// returns the names of installed configs that depend on the config
+func get_installed_requirements(kind Hw_kind, config *Hw_config) []string {
+	var requirements []string
+
+	for _, installed := range *get_installed_configs(kind) {
+		if slices.Contains(installed.Dependencies, config.Name) {
+			requirements = append(requirements, installed.Name)
+		}
+	}
+
+	return requirements
+}
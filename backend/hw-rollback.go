@@ -0,0 +1,183 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Installed configs and packages before a transaction, with a copy of the local config database
+// to reinstall removed configs in their previous version.
+type hw_snapshot struct {
+	kind       Hw_kind
+	backup_dir string
+	configs    []string
+	packages   []string
+
+	// Installed configs the transaction changes in place, always reinstalled from the backup
+	changed []string
+	// Configs the transaction installs, only their packages are removed again
+	installs []string
+}
+
+// Outcome of a config transaction for the frontend.
+type Hw_transaction_result struct {
+	Ok    bool
+	Error string
+	// The transaction failed and the previous installed configs were restored
+	Rolled_back bool
+}
+
+// Failure of a transaction together with the result of its rollback.
+type hw_rollback_error struct {
+	err, rollback_err error
+}
+
+func (e *hw_rollback_error) Error() string {
+	if e.rollback_err != nil {
+		return fmt.Sprintf("%v; rollback failed: %v", e.err, e.rollback_err)
+	}
+	return fmt.Sprintf("%v; rolled back to the previous configs", e.err)
+}
+
+func (e *hw_rollback_error) Unwrap() error {
+	return e.err
+}
+
+// returns the result of the transaction that returned the error
+func get_transaction_result(err error) Hw_transaction_result {
+	if err == nil {
+		return Hw_transaction_result{Ok: true}
+	}
+
+	result := Hw_transaction_result{Error: err.Error()}
+	var rollback_err *hw_rollback_error
+	if errors.As(err, &rollback_err) {
+		result.Rolled_back = rollback_err.rollback_err == nil
+	}
+	return result
+}
+
+// Runs the transaction, which installs the configs of installs, and restores the previous
+// installed configs if it fails. The returned error reports both the failure and the result of
+// the rollback.
+func with_rollback(kind Hw_kind, changed, installs []string, transaction func() error) error {
+	snapshot, err := take_snapshot(kind)
+	if err != nil {
+		return fmt.Errorf("failed to record the installed configs: %w", err)
+	}
+	defer os.RemoveAll(snapshot.backup_dir)
+	snapshot.changed = changed
+	snapshot.installs = installs
+
+	err = transaction()
+	if err == nil {
+		return nil
+	}
+
+	fmt.Println("> Operation failed, restoring the previous configs...")
+	rollback_err := snapshot.restore()
+	if rollback_err == nil {
+		fmt.Println("> Successfully restored", strings.Join(snapshot.configs, ", "))
+	}
+	return &hw_rollback_error{err: err, rollback_err: rollback_err}
+}
+
+func take_snapshot(kind Hw_kind) (*hw_snapshot, error) {
+	snapshot := hw_snapshot{kind: kind}
+
+	for _, cfg := range *get_installed_configs(kind) {
+		snapshot.configs = append(snapshot.configs, cfg.Name)
+	}
+
+	packages, err := get_pm_installed_packages()
+	if err != nil {
+		return nil, err
+	}
+	snapshot.packages = packages
+
+	snapshot.backup_dir, err = os.MkdirTemp("", "mcp-mhwd-")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(get_db_dir(kind)); err == nil {
+		if err := copy_directory(get_db_dir(kind), snapshot.backup_dir); err != nil {
+			os.RemoveAll(snapshot.backup_dir)
+			return nil, err
+		}
+	}
+
+	return &snapshot, nil
+}
+
+// Removes the configs added since the snapshot and the packages the transaction's configs added,
+// then reinstalls the removed configs from the backup. Packages installed by other operations in
+// the meantime are kept. Continues after failures to restore as much as possible.
+func (snapshot *hw_snapshot) restore() error {
+	var errs []error
+
+	var added []string
+	for _, cfg := range *get_installed_configs(snapshot.kind) {
+		if !slices.Contains(snapshot.configs, cfg.Name) {
+			added = append(added, cfg.Name)
+		}
+	}
+	// Removing a config refreshes the installed configs, look each one up again
+	for _, name := range added {
+		if config := find_config(get_installed_configs(snapshot.kind), name); config != nil {
+			errs = append(errs, remove_single_config(config))
+		}
+	}
+
+	// Packages of a config that failed before its files were copied
+	if packages, err := get_pm_installed_packages(); err != nil {
+		errs = append(errs, err)
+	} else {
+		var added_packages []string
+		for _, name := range snapshot.installs {
+			config := find_config(get_all_configs(snapshot.kind), name)
+			if config == nil {
+				continue
+			}
+			for _, pkg := range get_config_packages(config) {
+				if slices.Contains(packages, pkg) && !slices.Contains(snapshot.packages, pkg) &&
+					!slices.Contains(added_packages, pkg) {
+					added_packages = append(added_packages, pkg)
+				}
+			}
+		}
+		if len(added_packages) != 0 {
+			args := append(get_pm_args(), "-Rns")
+			if err := hw_run_privileged_cmd(nil, "pacman", append(args, added_packages...)...); err != nil {
+				errs = append(errs, fmt.Errorf("failed to remove added packages: %w", err))
+			}
+		}
+	}
+
+	for _, name := range snapshot.configs {
+		installed := find_config(get_installed_configs(snapshot.kind), name) != nil
+		if installed && !slices.Contains(snapshot.changed, name) {
+			continue
+		}
+
+		var config Hw_config
+		if !fill_config(&config, filepath.Join(snapshot.backup_dir, name, hw_mhwd_cfg_name), snapshot.kind) {
+			errs = append(errs, fmt.Errorf("backup of config '%s' is invalid", name))
+			continue
+		}
+		errs = append(errs, install_single_config(&config))
+	}
+
+	return errors.Join(errs...)
+}
+
+func get_pm_installed_packages() ([]string, error) {
+	var out strings.Builder
+	if err := hw_run_cmd(&out, "pacman", append(get_pm_args(), "-Qq")...); err != nil {
+		return nil, fmt.Errorf("failed to query installed packages: %w", err)
+	}
+	return strings.Fields(out.String()), nil
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const hw_sysfs_dir = "/sys"
+
+// Enumerates devices by reading sysfs. It does not need cgo or libhwinfo and can be pointed at a
+// fixture tree containing sys/ and usr/share/hwdata/.
+type sysfs_enumerator struct {
+	root string
+}
+
+func new_sysfs_enumerator(root string) *sysfs_enumerator {
+	return &sysfs_enumerator{root: root}
+}
+
+func (e *sysfs_enumerator) Devices(kind Hw_kind) []Hw_device {
+	if kind == Usb_kind {
+		return e.usb_devices()
+	}
+	return e.pci_devices()
+}
+
+func (e *sysfs_enumerator) pci_devices() []Hw_device {
+	var devices []Hw_device
+
+	for _, path := range e.bus_device_paths("pci") {
+		var dev Hw_device
+		dev.Kind = Pci_kind
+
+		// The class file holds base class, subclass and programming interface: 0x030000
+		class := read_sysfs_hex(path, "class")
+		if len(class) >= 4 {
+			dev.Class_id = class[:4]
+		}
+		dev.Vendor_id = read_sysfs_hex(path, "vendor")
+		dev.Device_id = read_sysfs_hex(path, "device")
+		dev.Subvendor_id = read_sysfs_hex(path, "subsystem_vendor")
+		dev.Subdevice_id = read_sysfs_hex(path, "subsystem_device")
+
+		get_ids_db(e.root, Pci_kind).set_names(&dev)
+		e.set_sysfs_ids(&dev, path)
+
+		devices = append(devices, dev)
+	}
+
+	return devices
+}
+
+func (e *sysfs_enumerator) usb_devices() []Hw_device {
+	var devices []Hw_device
+
+	for _, path := range e.bus_device_paths("usb") {
+		// Interfaces ("1-1:1.0") are part of their device
+		if strings.Contains(filepath.Base(path), ":") {
+			continue
+		}
+
+		var dev Hw_device
+		dev.Kind = Usb_kind
+
+		dev.Vendor_id = read_sysfs_hex(path, "idVendor")
+		dev.Device_id = read_sysfs_hex(path, "idProduct")
+		if dev.Vendor_id == "" {
+			continue
+		}
+
+		// Class 00 means the class is defined by the interfaces, use the first one then
+		dev.Class_id = read_sysfs_hex(path, "bDeviceClass") + read_sysfs_hex(path, "bDeviceSubClass")
+		if strings.HasPrefix(dev.Class_id, "00") {
+			if interfaces := get_usb_interface_dirs(path); len(interfaces) != 0 {
+				dev.Class_id = read_sysfs_hex(interfaces[0], "bInterfaceClass") +
+					read_sysfs_hex(interfaces[0], "bInterfaceSubClass")
+			}
+		}
+
+		get_ids_db(e.root, Usb_kind).set_names(&dev)
+		if dev.Device_name == "" {
+			dev.Device_name = read_sysfs_string(path, "product")
+		}
+		if dev.Vendor_name == "" {
+			dev.Vendor_name = read_sysfs_string(path, "manufacturer")
+		}
+		dev.Serial = read_sysfs_string(path, "serial")
+		e.set_sysfs_ids(&dev, path)
+
+		devices = append(devices, dev)
+	}
+
+	return devices
+}
+
+// returns the sorted interface directories of the USB device, "1-7/1-7:1.0" for "1-7"
+func get_usb_interface_dirs(device_dir string) []string {
+	interfaces, _ := filepath.Glob(filepath.Join(device_dir, filepath.Base(device_dir)+":*"))
+	sort.Strings(interfaces)
+	return interfaces
+}
+
+// returns the sorted device paths of the bus
+func (e *sysfs_enumerator) bus_device_paths(bus string) []string {
+	paths, _ := filepath.Glob(filepath.Join(e.root, hw_sysfs_dir, "bus", bus, "devices", "*"))
+	sort.Strings(paths)
+	return paths
+}
+
+func (e *sysfs_enumerator) set_sysfs_ids(dev *Hw_device, path string) {
+	dev.Sysfs_bus_id = filepath.Base(path)
+
+	// Bus entries link to the device, which is identified by its path below the sysfs directory
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		if rel, err := filepath.Rel(filepath.Join(e.root, hw_sysfs_dir), target); err == nil {
+			dev.Sysfs_id = "/" + rel
+		}
+	}
+}
+
+func read_sysfs_string(dir, name string) string {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// returns the hex value of the attribute in lower case without 0x prefix
+func read_sysfs_hex(dir, name string) string {
+	return strings.TrimPrefix(strings.ToLower(read_sysfs_string(dir, name)), "0x")
+}
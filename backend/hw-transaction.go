@@ -0,0 +1,142 @@
+package backend
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Marks the line of the privileged process holding the transaction result as JSON.
+const hw_transaction_result_prefix = "hw-transaction-result: "
+
+// Config operation run as one privileged process.
+type Hw_transaction_request struct {
+	// "install", "remove", "execute-install", "execute-remove", "update" or "auto-install"
+	Op   string
+	Kind Hw_kind
+	Name string
+	// Devices of an "auto-install" transaction
+	Auto_install Hw_auto_install
+
+	// State of the application the process starts from
+	Sync_pm_db  bool
+	Config_dirs []string
+}
+
+// Runs the request with all of its steps, the rollback included, in one process started through
+// pkexec. The password is asked once, and a cancelled prompt leaves the database untouched.
+func run_privileged_transaction(request Hw_transaction_request) Hw_transaction_result {
+	if os.Geteuid() == 0 {
+		return get_transaction_result(exec_transaction(request))
+	}
+
+	result := run_transaction_process(request)
+
+	// The database changed in the other process
+	update_installed_configs()
+	if result.Ok {
+		hw_sync_pm_db = false
+	}
+	return result
+}
+
+// Starts the application as `hw-transaction` subcommand through pkexec and returns the result it
+// reports. Its other output is forwarded to stdout.
+func run_transaction_process(request Hw_transaction_request) Hw_transaction_result {
+	exe, err := os.Executable()
+	if err != nil {
+		return get_transaction_result(err)
+	}
+
+	request.Sync_pm_db = hw_sync_pm_db
+	request.Config_dirs = Hwmgr.Config_dirs
+	data, err := json.Marshal(request)
+	if err != nil {
+		return get_transaction_result(err)
+	}
+
+	output := &hw_transaction_output{}
+	err = hw_run_cmd(output, "pkexec", exe, "hw-transaction", string(data))
+	output.flush()
+
+	if output.result == nil {
+		// Authentication was cancelled or the process didn't get to run the transaction
+		return get_transaction_result(fmt.Errorf("privileged transaction failed: %v", err))
+	}
+	return *output.result
+}
+
+// Runs the request in the privileged process and prints its result for run_transaction_process.
+func Run_hw_transaction(request Hw_transaction_request) Hw_transaction_result {
+	Hwmgr.Config_dirs = request.Config_dirs
+	hw_sync_pm_db = request.Sync_pm_db
+
+	Fill_devices()
+	Update_configs()
+
+	result := get_transaction_result(exec_transaction(request))
+
+	data, _ := json.Marshal(result)
+	fmt.Println(hw_transaction_result_prefix + string(data))
+	return result
+}
+
+func exec_transaction(request Hw_transaction_request) error {
+	switch request.Op {
+	case "install":
+		return install_config(request.Kind, request.Name)
+	case "remove":
+		return remove_config(request.Kind, request.Name)
+	case "execute-install":
+		plan := resolve_install(request.Kind, request.Name)
+		return execute_plan(&plan)
+	case "execute-remove":
+		plan := resolve_remove(request.Kind, request.Name)
+		return execute_plan(&plan)
+	case "update":
+		return update_config(request.Kind, request.Name)
+	case "auto-install":
+		_, err := auto_install_configs(request.Auto_install)
+		return err
+	}
+	return fmt.Errorf("unknown transaction '%s'", request.Op)
+}
+
+// Forwards the output of the privileged process to stdout and picks up its result line.
+type hw_transaction_output struct {
+	pending []byte
+	result  *Hw_transaction_result
+}
+
+func (output *hw_transaction_output) Write(data []byte) (int, error) {
+	output.pending = append(output.pending, data...)
+	for {
+		i := bytes.IndexByte(output.pending, '\n')
+		if i < 0 {
+			break
+		}
+		output.line(string(output.pending[:i]))
+		output.pending = output.pending[i+1:]
+	}
+	return len(data), nil
+}
+
+func (output *hw_transaction_output) flush() {
+	if len(output.pending) != 0 {
+		output.line(string(output.pending))
+		output.pending = nil
+	}
+}
+
+func (output *hw_transaction_output) line(line string) {
+	if data, found := strings.CutPrefix(line, hw_transaction_result_prefix); found {
+		var result Hw_transaction_result
+		if err := json.Unmarshal([]byte(data), &result); err == nil {
+			output.result = &result
+			return
+		}
+	}
+	fmt.Println(line)
+}
@@ -0,0 +1,161 @@
+package backend
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Compares config versions like "2023.09.12" or "1.2.3-1" segment by segment, numeric segments by
+// value. returns -1, 0 or 1 if a is older than, equal to or newer than b.
+func compare_versions(a, b string) int {
+	split := func(version string) []string {
+		return strings.FieldsFunc(version, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+	}
+	a_segments, b_segments := split(a), split(b)
+
+	for i := 0; i < len(a_segments) && i < len(b_segments); i++ {
+		a_num, a_err := strconv.Atoi(a_segments[i])
+		b_num, b_err := strconv.Atoi(b_segments[i])
+
+		switch {
+		case a_err == nil && b_err == nil:
+			if a_num != b_num {
+				return cmp.Compare(a_num, b_num)
+			}
+		// Numeric segments are newer than alphabetic ones, like pacman's vercmp
+		case a_err == nil:
+			return 1
+		case b_err == nil:
+			return -1
+		default:
+			if c := strings.Compare(a_segments[i], b_segments[i]); c != 0 {
+				return c
+			}
+		}
+	}
+
+	return cmp.Compare(len(a_segments), len(b_segments))
+}
+
+// Marks the installed configs of the kind that have a newer version in the database.
+func set_config_updates(kind Hw_kind) {
+	installed := get_installed_configs(kind)
+	for i := range *installed {
+		cfg := &(*installed)[i]
+		db_config := find_config(get_all_configs(kind), cfg.Name)
+		if db_config != nil && compare_versions(db_config.Version, cfg.Version) > 0 {
+			cfg.Update_version = db_config.Version
+		}
+	}
+}
+
+func set_device_updates(devices []Hw_device) {
+	for i := range devices {
+		devices[i].Update_available = false
+		for _, cfg := range devices[i].Installed_configs {
+			if cfg.Update_version != "" {
+				devices[i].Update_available = true
+			}
+		}
+	}
+}
+
+// returns the installed configs with a newer version in the database
+func get_config_updates() []Hw_config {
+	var updates []Hw_config
+	for _, configs := range [][]Hw_config{Hwmgr.Installed_pci_configs, Hwmgr.Installed_usb_configs} {
+		for _, cfg := range configs {
+			if cfg.Update_version != "" {
+				updates = append(updates, cfg)
+			}
+		}
+	}
+	return updates
+}
+
+// Replaces the installed config by its newer database version. The post_remove of the installed
+// version runs, packages only it needed are removed, then the new version is installed together
+// with dependencies it added.
+func update_config(kind Hw_kind, name string) error {
+	installed := find_config(get_installed_configs(kind), name)
+	if installed == nil {
+		return fmt.Errorf("config '%s' is not installed", name)
+	}
+	if installed.Update_version == "" {
+		return fmt.Errorf("config '%s' is up to date", name)
+	}
+	config := find_config(get_all_configs(kind), name)
+	if config == nil {
+		return fmt.Errorf("config '%s' does not exist", name)
+	}
+
+	var configs []*Hw_config
+	if err := add_dependencies_to_install(kind, config, &configs, []string{name}, nil); err != nil {
+		return err
+	}
+
+	// New conflicts are not resolved implicitly, the user has to remove the other configs
+	var conflicts []string
+	for _, cfg := range configs {
+		for _, conflict := range get_installed_conflicts(kind, cfg) {
+			if conflict != name {
+				conflicts = append(conflicts, cfg.Name+" conflicts with installed "+conflict)
+			}
+		}
+	}
+	if len(conflicts) != 0 {
+		return fmt.Errorf("%s", strings.Join(conflicts, "; "))
+	}
+
+	var installs []string
+	for _, cfg := range configs {
+		installs = append(installs, cfg.Name)
+	}
+
+	return with_rollback(kind, []string{name}, installs, func() error {
+		return update_config_steps(installed, config, configs)
+	})
+}
+
+// Removes the installed version and installs the configs, the updated config last.
+func update_config_steps(installed, config *Hw_config, configs []*Hw_config) error {
+	name := installed.Name
+	fmt.Println("> Updating", name, installed.Version, "to", config.Version+"...")
+
+	if err := run_mhwd_script(installed, false); err != nil {
+		return fmt.Errorf("post remove of config '%s' failed: %w", name, err)
+	}
+
+	exclusive, err := get_exclusive_packages(installed)
+	if err != nil {
+		return err
+	}
+	var dropped []string
+	for _, pkg := range exclusive {
+		if !slices.Contains(get_config_packages(config), pkg) {
+			dropped = append(dropped, pkg)
+		}
+	}
+	if len(dropped) != 0 {
+		args := append(get_pm_args(), "-Rns")
+		if err := hw_run_privileged_cmd(nil, "pacman", append(args, dropped...)...); err != nil {
+			return fmt.Errorf("failed to remove packages dropped by config '%s': %w", name, err)
+		}
+	}
+
+	// Installing over the local copy replaces it
+	for _, cfg := range configs {
+		if err := install_single_config(cfg); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("> Successfully updated", name)
+	return nil
+}
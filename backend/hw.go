@@ -1,90 +1,67 @@
 package backend
 
-/*
-#cgo pkg-config: hwinfo
-#include "hwinfo-helpers.h"
-*/
-import "C"
 import (
 	"fmt"
-	"os"
-	"os/exec"
-	"strings"
-	"unsafe"
+	"sync"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
 )
 
 var hw_sync_pm_db = true
 
+// Source of the devices on a bus.
+type Hw_enumerator interface {
+	Devices(kind Hw_kind) []Hw_device
+}
+
+// Reads sysfs by default, builds with the hwinfo tag use libhwinfo instead.
+var hw_enumerator Hw_enumerator = new_sysfs_enumerator("/")
+
 type Hw_manager struct {
-	impl C.hw_manager
-	App  *application.App
+	App *application.App
 
 	Usb_devices, Pci_devices []Hw_device
 
+	// User-supplied config roots, searched before the system ones
+	Config_dirs []string
+
 	Installed_usb_configs, Installed_pci_configs []Hw_config
 	All_usb_configs, All_pci_configs             []Hw_config
 	Invalid_configs                              []Hw_config
+
+	// Inverted indexes of All_usb_configs and All_pci_configs
+	usb_config_index, pci_config_index *hw_config_index
 }
 
 var Hwmgr Hw_manager
 
-func Fill_devices() {
-	Hwmgr.Pci_devices = get_devices(Pci_kind)
-	Hwmgr.Usb_devices = get_devices(Usb_kind)
-}
+// Kept outside of Hw_manager, which is copied to save and restore its state.
+var hw_manager_mutex sync.Mutex
 
-func from_hex(hexnum uint16, fill int) string {
-	return fmt.Sprintf("%0*x", fill, hexnum)
+// Serializes access to the devices and configs of Hwmgr. Hotplug rescans replace them and config
+// operations change them, callers running concurrently to those hold the lock.
+func Lock_hw_manager() {
+	hw_manager_mutex.Lock()
 }
 
-func from_char_array(c *C.char) string {
-	if c == nil {
-		return ""
-	}
-	return C.GoString(c)
+func Unlock_hw_manager() {
+	hw_manager_mutex.Unlock()
 }
 
-func get_devices(kind Hw_kind) []Hw_device {
-	var ckind C.hwtype
-	if kind == Usb_kind {
-		ckind = C.HWUSB
-	} else {
-		ckind = C.HWPCI
-	}
-
-	hw_list := C.hw_get_devices(ckind)
-
-	var devices []Hw_device
-
-	for hd := hw_list.first; hd != nil; hd = hd.next {
-		var dev Hw_device
-		dev.Kind = kind
-
-		dev.Class_id = from_hex(uint16(hd.base_class.id), 2) +
-			strings.ToLower(from_hex(uint16(hd.sub_class.id), 2))
-		dev.Vendor_id = strings.ToLower(from_hex(uint16(hd.vendor.id), 4))
-		dev.Subvendor_id = strings.ToLower(from_hex(uint16(hd.sub_vendor.id), 4))
-		dev.Device_id = strings.ToLower(from_hex(uint16(hd.device.id), 4))
-
-		dev.Model = from_char_array(hd.model)
+func Fill_devices() {
+	Hwmgr.Pci_devices = hw_enumerator.Devices(Pci_kind)
+	Hwmgr.Usb_devices = hw_enumerator.Devices(Usb_kind)
 
-		dev.Class_name = from_char_array(hd.base_class.name)
-		dev.Vendor_name = from_char_array(hd.vendor.name)
-		dev.Subvendor_name = from_char_array(hd.sub_vendor.name)
-		dev.Device_name = from_char_array(hd.device.name)
-		dev.Sysfs_bus_id = from_char_array(hd.sysfs_bus_id)
-		dev.Sysfs_id = from_char_array(hd.sysfs_id)
+	fill_device_names(Hwmgr.Pci_devices)
+	fill_device_names(Hwmgr.Usb_devices)
 
-		devices = append(devices, dev)
+	// Replayed devices carry their recorded details, sysfs belongs to another machine
+	if _, replayed := hw_enumerator.(fixture_enumerator); replayed {
+		return
 	}
 
-	C.hd_free_hd_list(hw_list.first)
-	C.hd_free_hd_data(hw_list.data)
-	C.free(unsafe.Pointer(hw_list.data))
-
-	return devices
+	fill_device_details(Hwmgr.Pci_devices)
+	fill_device_details(Hwmgr.Usb_devices)
 }
 
 func (mgr *Hw_manager) Install_free_gpu_config() bool {
@@ -98,44 +75,132 @@ func (mgr *Hw_manager) Install_proprietary_gpu_config() bool {
 }
 
 func install_gpu_config(sel string) bool {
-	// Arguments for the installation process
-	args := []string{"-a", "pci", sel, "0300"}
+	_, ok := Hwmgr.Auto_install(Hw_auto_install{Kinds: []Hw_kind{Pci_kind}, Class_id: "0300",
+		Free_only: sel == "free"})
+	return ok
+}
 
-	if err := exec_mhwd(args); err != nil {
-		fmt.Println("Install failed: ", err)
-		return false
+// Sets up the selected devices with their recommended configs, or only returns the choices on
+// a dry run.
+func (mgr *Hw_manager) Auto_install(request Hw_auto_install) ([]Hw_auto_install_choice, bool) {
+	// The choices are made here, the installs run as one privileged transaction
+	dry_run := request
+	dry_run.Dry_run = true
+	choices, _ := auto_install_configs(dry_run)
+	for _, choice := range choices {
+		if choice.Config == "" {
+			fmt.Println("Warning: no config found for device", choice.Sysfs_bus_id+":", choice.Error)
+		}
+	}
+	if request.Dry_run {
+		return choices, true
+	}
+
+	result := run_privileged_transaction(Hw_transaction_request{Op: "auto-install", Auto_install: request})
+	set_auto_install_results(choices, result)
+	if !result.Ok {
+		fmt.Println("Install failed: ", result.Error)
+		return choices, false
 	}
 
 	fmt.Println("Installation completed successfully.")
-	return true
+	return choices, true
 }
 
-func (mgr *Hw_manager) Install_pci_config(name string) bool {
+func (mgr *Hw_manager) Install_pci_config(name string) Hw_transaction_result {
 	fmt.Println("MHWD will install the '", name, "' configuration.")
-	return exec_pci_config_op(name, "-i")
+	return exec_config_op(Pci_kind, name, true)
 }
 
-func (mgr *Hw_manager) Remove_pci_config(name string) bool {
+func (mgr *Hw_manager) Remove_pci_config(name string) Hw_transaction_result {
 	fmt.Println("MHWD will remove the '", name, "' configuration.")
-	return exec_pci_config_op(name, "-r")
+	return exec_config_op(Pci_kind, name, false)
+}
+
+func (mgr *Hw_manager) Install_usb_config(name string) Hw_transaction_result {
+	fmt.Println("MHWD will install the '", name, "' USB configuration.")
+	return exec_config_op(Usb_kind, name, true)
 }
 
-func exec_pci_config_op(name string, sel string) bool {
-	// Arguments for the installation process
-	args := []string{sel, "pci", name}
+func (mgr *Hw_manager) Remove_usb_config(name string) Hw_transaction_result {
+	fmt.Println("MHWD will remove the '", name, "' USB configuration.")
+	return exec_config_op(Usb_kind, name, false)
+}
+
+func exec_config_op(kind Hw_kind, name string, install bool) Hw_transaction_result {
+	op_long := "install"
+	if !install {
+		op_long = "remove"
+	}
+
+	result := run_privileged_transaction(Hw_transaction_request{Op: op_long, Kind: kind, Name: name})
+	if !result.Ok {
+		fmt.Println("Operation failed: ", result.Error)
+		return result
+	}
+
+	fmt.Println("MHWD " + op_long + "-operation completed successfully.")
+	return result
+}
 
-	if err := exec_mhwd(args); err != nil {
+// returns the installed configs with a newer version in the database
+func (mgr *Hw_manager) Get_config_updates() []Hw_config {
+	return get_config_updates()
+}
+
+func (mgr *Hw_manager) Update_config(kind Hw_kind, name string) Hw_transaction_result {
+	fmt.Println("MHWD will update the '", name, "' configuration.")
+
+	result := run_privileged_transaction(Hw_transaction_request{Op: "update", Kind: kind, Name: name})
+	if !result.Ok {
+		fmt.Println("Operation failed: ", result.Error)
+		return result
+	}
+
+	fmt.Println("MHWD update-operation completed successfully.")
+	return result
+}
+
+func (mgr *Hw_manager) Install_firmware(pkgs []string) bool {
+	fmt.Println("Installing firmware packages", pkgs)
+
+	if err := install_firmware_packages(pkgs); err != nil {
 		fmt.Println("Operation failed: ", err)
 		return false
 	}
 
-	fmt.Println("MHWD " + sel + "-operation completed successfully.")
+	fmt.Println("Firmware installed, reload the drivers or reboot to use it.")
 	return true
 }
 
-func exec_mhwd(args []string) error {
-	cmd := exec.Command("mhwd", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+func (mgr *Hw_manager) Resolve_install(kind Hw_kind, name string) Hw_plan {
+	return resolve_install(kind, name)
+}
+
+func (mgr *Hw_manager) Resolve_remove(kind Hw_kind, name string) Hw_plan {
+	return resolve_remove(kind, name)
+}
+
+// Resolves the request again and executes it, including the removal of conflicting configs on
+// install and of depending configs on remove.
+func (mgr *Hw_manager) Execute_plan(kind Hw_kind, name string, install bool) Hw_transaction_result {
+	var plan Hw_plan
+	request := Hw_transaction_request{Op: "execute-install", Kind: kind, Name: name}
+	if install {
+		plan = resolve_install(kind, name)
+	} else {
+		plan = resolve_remove(kind, name)
+		request.Op = "execute-remove"
+	}
+
+	fmt.Println("MHWD will remove", plan.Remove, "and install", plan.Install)
+
+	result := run_privileged_transaction(request)
+	if !result.Ok {
+		fmt.Println("Operation failed: ", result.Error)
+		return result
+	}
+
+	fmt.Println("MHWD plan completed successfully.")
+	return result
 }
@@ -0,0 +1,50 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFillAllConfigsShadowing(t *testing.T) {
+	saved_mgr, saved_root := Hwmgr, hw_root
+	defer func() { Hwmgr, hw_root = saved_mgr, saved_root }()
+
+	hw_root = t.TempDir()
+	user_root := t.TempDir()
+	Hwmgr = Hw_manager{Config_dirs: []string{user_root}}
+
+	write := func(root, dir, name string) {
+		path := filepath.Join(root, "pci", dir, hw_mhwd_cfg_name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("NAME=\""+name+"\"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(user_root, "a", "video-test")
+	write(hw_path(hw_mhwd_cfg_dir), "a", "video-test")
+	// Created in reverse order, the first path in sorted order is kept
+	write(hw_path(hw_mhwd_cfg_dir), "c", "video-other")
+	write(hw_path(hw_mhwd_cfg_dir), "b", "video-other")
+
+	fill_all_configs(Pci_kind)
+
+	if len(Hwmgr.All_pci_configs) != 2 {
+		t.Fatal("expected 2 configs, got", len(Hwmgr.All_pci_configs))
+	}
+	if shadowed := find_config(&Hwmgr.All_pci_configs, "video-test").Shadowed; len(shadowed) != 1 {
+		t.Error("expected the config of the other root shadowed, got", shadowed)
+	}
+	if shadowed := find_config(&Hwmgr.All_pci_configs, "video-other").Shadowed; len(shadowed) != 0 {
+		t.Error("a config of the same root is not shadowed, got", shadowed)
+	}
+	if path := find_config(&Hwmgr.All_pci_configs, "video-other").Base_path; filepath.Base(path) != "b" {
+		t.Error("expected the config of the first path kept, got", path)
+	}
+	if len(Hwmgr.Invalid_configs) != 1 || Hwmgr.Invalid_configs[0].Name != "video-other" ||
+		filepath.Base(Hwmgr.Invalid_configs[0].Base_path) != "c" {
+		t.Error("expected the duplicate of the later path as invalid config, got", Hwmgr.Invalid_configs)
+	}
+}
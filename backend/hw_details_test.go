@@ -0,0 +1,85 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Builds a sysfs tree with a USB Wi-Fi dongle, its interface bound to r8188eu and the device node
+// bound to the generic usb driver.
+func setup_test_sysfs(t *testing.T) string {
+	root := t.TempDir()
+
+	write := func(path, data string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(path, target string) {
+		path = filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(filepath.Join(root, target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		rel, err := filepath.Rel(filepath.Dir(path), filepath.Join(root, target))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(rel, path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dev := "sys/devices/pci0000:00/0000:00:14.0/usb1/1-7"
+	write(dev+"/idVendor", "0bda")
+	write(dev+"/idProduct", "8179")
+	write(dev+"/bDeviceClass", "00")
+	write(dev+"/bDeviceSubClass", "00")
+	link(dev+"/driver", "sys/bus/usb/drivers/usb")
+
+	write(dev+"/1-7:1.0/bInterfaceClass", "ff")
+	write(dev+"/1-7:1.0/bInterfaceSubClass", "ff")
+	write(dev+"/1-7:1.0/modalias", "usb:v0BDAp8179d0000dc00dsc00dp00icFFiscFFipFFin00")
+	link(dev+"/1-7:1.0/driver", "sys/bus/usb/drivers/r8188eu")
+
+	link("sys/bus/usb/devices/1-7", dev)
+	link("sys/bus/usb/devices/1-7:1.0", dev+"/1-7:1.0")
+
+	write("proc/sys/kernel/osrelease", "6.12.0-test")
+	write("lib/modules/6.12.0-test/modules.alias",
+		"alias usb:v0BDAp8179d*dc*dsc*dp*ic*isc*ip*in* r8188eu\n"+
+			"alias usb:v*p*d*dc*dsc*dp*ic09isc00ip*in* usbcore")
+
+	return root
+}
+
+func TestFillUsbDeviceDetails(t *testing.T) {
+	saved_root := hw_root
+	defer func() { hw_root = saved_root }()
+	hw_root = setup_test_sysfs(t)
+
+	devices := new_sysfs_enumerator(hw_root).Devices(Usb_kind)
+	if len(devices) != 1 {
+		t.Fatal("expected the device without its interface, got", devices)
+	}
+	fill_device_details(devices)
+
+	dev := devices[0]
+	if dev.Class_id != "ffff" {
+		t.Error("expected the class of the interface, got", dev.Class_id)
+	}
+	if dev.Driver != "r8188eu" {
+		t.Error("expected the driver of the interface, got", dev.Driver)
+	}
+	if !slices.Equal(dev.Modules, []string{"r8188eu"}) {
+		t.Error("expected the modules of the interface modalias, got", dev.Modules)
+	}
+}
@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Matches the configs of testdata/root against every recorded machine in testdata/fixtures.
+func TestFixtures(t *testing.T) {
+	fixtures, err := filepath.Glob("testdata/fixtures/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		t.Fatal("no fixtures found")
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(strings.TrimSuffix(filepath.Base(fixture), ".json"), func(t *testing.T) {
+			problems, err := Check_fixture(fixture, "testdata/root")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, problem := range problems {
+				t.Error(problem)
+			}
+		})
+	}
+}
+
+// Replays the devices of the fixture against the configs of testdata/root.
+func load_test_fixture(t *testing.T, name string) {
+	fixture, err := Load_fixture(filepath.Join("testdata/fixtures", name+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved_mgr, saved_enumerator, saved_root := Hwmgr, hw_enumerator, hw_root
+	t.Cleanup(func() { Hwmgr, hw_enumerator, hw_root = saved_mgr, saved_enumerator, saved_root })
+
+	hw_root = "testdata/root"
+	hw_enumerator = fixture_enumerator{fixture}
+	Hwmgr = Hw_manager{}
+	Fill_devices()
+	Update_configs()
+}
+
+// Devices that differ only in their subsystem IDs get the configs listing or blacklisting them.
+func TestFixtureSubsystemIds(t *testing.T) {
+	load_test_fixture(t, "rtl8821ce-subsystems")
+
+	expected := map[string][]string{
+		// Listed subsystem vendor
+		"0000:02:00.0": {"network-rtl8821ce-oem"},
+		// Listed subsystem vendor with a blacklisted subsystem device, blacklisted subsystem vendor
+		"0000:03:00.0": nil,
+		// Subsystem vendor not listed, any other is allowed
+		"0000:04:00.0": {"network-rtl8821ce"},
+	}
+	for _, dev := range Hwmgr.Pci_devices {
+		if dev.Vendor_id != "10ec" || dev.Device_id != "c821" {
+			t.Fatal("expected only RTL8821CE cards, got", dev.Vendor_id+":"+dev.Device_id)
+		}
+
+		var actual []string
+		for _, cfg := range dev.Available_configs {
+			actual = append(actual, cfg.Name)
+		}
+		if !slices.Equal(actual, expected[dev.Sysfs_bus_id]) {
+			t.Errorf("%s (%s:%s): expected %v, got %v", dev.Sysfs_bus_id, dev.Subvendor_id, dev.Subdevice_id,
+				expected[dev.Sysfs_bus_id], actual)
+		}
+	}
+	if len(Hwmgr.Pci_devices) != len(expected) {
+		t.Error("expected", len(expected), "devices, got", len(Hwmgr.Pci_devices))
+	}
+}
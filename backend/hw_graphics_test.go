@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckGraphicsStatus(t *testing.T) {
+	saved_run_cmd := hw_run_cmd
+	defer func() { hw_run_cmd = saved_run_cmd }()
+
+	// No steam, the 32-bit libraries are not checked
+	hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+		return nil
+	}
+
+	nvidia_icd := Hw_vulkan_icd{File: "/usr/share/vulkan/icd.d/nvidia_icd.json", Library: "libGLX_nvidia.so.0",
+		Present: true}
+	xorg := Hw_xorg_file{File: "/etc/X11/xorg.conf.d/90-mhwd.conf", Mhwd: true, Drivers: []string{"nvidia"}}
+
+	for _, test := range []struct {
+		name     string
+		status   Hw_graphics_status
+		expected []string
+	}{
+		{
+			"nvidia config installed, nouveau bound",
+			Hw_graphics_status{
+				Gpus: []Hw_graphics_gpu{{Sysfs_bus_id: "0000:01:00.0", Model: "GeForce GTX 1060", Vendor_id: "10de",
+					Driver: "nouveau", Installed_configs: []string{"video-nvidia"}}},
+				Glx_vendors: []string{"mesa", "nvidia"},
+				Vulkan_icds: []Hw_vulkan_icd{nvidia_icd},
+				Xorg_files:  []Hw_xorg_file{xorg},
+			},
+			[]string{
+				"video-nvidia is installed, but GeForce GTX 1060 (0000:01:00.0) is driven by nouveau",
+				"/etc/X11/xorg.conf.d/90-mhwd.conf configures the nvidia driver, but no GPU is driven by nvidia",
+			},
+		},
+		{
+			"Xorg file left over without config",
+			Hw_graphics_status{
+				Gpus: []Hw_graphics_gpu{{Sysfs_bus_id: "0000:01:00.0", Model: "GeForce GTX 1060", Vendor_id: "10de",
+					Driver: "nouveau"}},
+				Glx_vendors: []string{"mesa"},
+				Xorg_files:  []Hw_xorg_file{xorg},
+			},
+			[]string{
+				"/etc/X11/xorg.conf.d/90-mhwd.conf configures the nvidia driver, but no NVIDIA config is installed",
+			},
+		},
+		{
+			"nvidia config working",
+			Hw_graphics_status{
+				Gpus: []Hw_graphics_gpu{{Sysfs_bus_id: "0000:01:00.0", Model: "GeForce GTX 1060", Vendor_id: "10de",
+					Driver: "nvidia", Installed_configs: []string{"video-nvidia"}}},
+				Glx_vendors: []string{"nvidia"},
+				Vulkan_icds: []Hw_vulkan_icd{nvidia_icd},
+				Xorg_files:  []Hw_xorg_file{xorg},
+			},
+			nil,
+		},
+	} {
+		if actual := check_graphics_status(&test.status); !slices.Equal(actual, test.expected) {
+			t.Errorf("%s: expected\n\t%s\ngot\n\t%s", test.name, strings.Join(test.expected, "\n\t"),
+				strings.Join(actual, "\n\t"))
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package backend
+
+import (
+	"io"
+	"os/exec"
+	"testing"
+)
+
+func TestGetHybridGraphics(t *testing.T) {
+	saved_mgr, saved_root := Hwmgr, hw_root
+	defer func() { Hwmgr, hw_root = saved_mgr, saved_root }()
+	hw_root = t.TempDir()
+
+	intel := Hw_device{Kind: Pci_kind, Class_id: "0300", Vendor_id: "8086", Sysfs_bus_id: "0000:00:02.0"}
+	nvidia := Hw_device{Kind: Pci_kind, Class_id: "0300", Vendor_id: "10de", Sysfs_bus_id: "0000:01:00.0"}
+	nvidia_3d := Hw_device{Kind: Pci_kind, Class_id: "0302", Vendor_id: "10de", Sysfs_bus_id: "0000:02:00.0"}
+	amd := Hw_device{Kind: Pci_kind, Class_id: "0380", Vendor_id: "1002", Sysfs_bus_id: "0000:03:00.0"}
+	amd_apu := Hw_device{Kind: Pci_kind, Class_id: "0300", Vendor_id: "1002", Sysfs_bus_id: "0000:05:00.0"}
+	audio := Hw_device{Kind: Pci_kind, Class_id: "0403", Vendor_id: "10de", Sysfs_bus_id: "0000:01:00.1"}
+
+	// MUX laptop booted on the discrete GPU
+	nvidia_mux := nvidia
+	nvidia_mux.Boot_vga = true
+
+	for _, test := range []struct {
+		devices  []Hw_device
+		hybrid   bool
+		discrete string
+	}{
+		{[]Hw_device{intel, nvidia, audio}, true, nvidia.Sysfs_bus_id},
+		{[]Hw_device{nvidia_mux, intel}, true, nvidia.Sysfs_bus_id},
+		{[]Hw_device{intel, nvidia_3d}, true, nvidia_3d.Sysfs_bus_id},
+		{[]Hw_device{intel, amd}, true, amd.Sysfs_bus_id},
+		{[]Hw_device{amd_apu, nvidia}, true, nvidia.Sysfs_bus_id},
+		// Two GPUs of the same vendor are not hybrid
+		{[]Hw_device{nvidia, nvidia_3d}, false, ""},
+		{[]Hw_device{intel, audio}, false, ""},
+	} {
+		Hwmgr = Hw_manager{Pci_devices: test.devices}
+		hybrid := Get_hybrid_graphics()
+		if hybrid.Hybrid != test.hybrid || hybrid.Discrete != test.discrete {
+			t.Errorf("%v: expected hybrid %v with discrete %q, got %v with %q",
+				test.devices, test.hybrid, test.discrete, hybrid.Hybrid, hybrid.Discrete)
+		}
+		for _, gpu := range hybrid.Gpus {
+			if gpu.Class_id == "0403" {
+				t.Error("audio device taken for a GPU")
+			}
+		}
+	}
+}
+
+func TestSetOffloadSettings(t *testing.T) {
+	saved_mgr, saved_root, saved_run_cmd := Hwmgr, hw_root, hw_run_cmd
+	defer func() { Hwmgr, hw_root, hw_run_cmd = saved_mgr, saved_root, saved_run_cmd }()
+
+	hw_root = t.TempDir()
+	hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+		if name == "pkexec" {
+			name, args = args[0], args[1:]
+		}
+		return exec.Command(name, args...).Run()
+	}
+	Hwmgr = Hw_manager{Pci_devices: []Hw_device{
+		{Kind: Pci_kind, Class_id: "0300", Vendor_id: "8086", Sysfs_bus_id: "0000:00:02.0", Boot_vga: true},
+		{Kind: Pci_kind, Class_id: "0302", Vendor_id: "10de", Sysfs_bus_id: "0000:01:00.0", Driver: "nvidia"},
+	}}
+
+	if err := Set_module_options("nvidia", "modeset=1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Set_offload_settings(Hw_offload_settings{Dynamic_power_management: true}); err != nil {
+		t.Fatal(err)
+	}
+	if options := read_module_policy().Options["nvidia"]; options != "modeset=1 "+hw_nvidia_pm_option {
+		t.Error("expected the option added to the module policy, got", options)
+	}
+	if !read_offload_settings().Dynamic_power_management {
+		t.Error("dynamic power management is not read back")
+	}
+
+	if err := Set_offload_settings(Hw_offload_settings{}); err != nil {
+		t.Fatal(err)
+	}
+	if options := read_module_policy().Options["nvidia"]; options != "modeset=1" {
+		t.Error("expected only the option removed, got", options)
+	}
+}
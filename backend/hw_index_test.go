@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+var test_vendors = []string{"10de", "1002", "8086", "14e4", "10ec", "168c"}
+
+// Generates a database like the proprietary driver configs: about 500 configs, some listing
+// thousands of device IDs, with wildcards, blacklists and configs of more than one ID group.
+func generate_test_configs(rng *rand.Rand) []Hw_config {
+	id := func() string { return fmt.Sprintf("%04x", rng.Intn(0x10000)) }
+	ids := func(n int) []string {
+		list := make([]string, n)
+		for i := range list {
+			list[i] = id()
+		}
+		return list
+	}
+
+	var configs []Hw_config
+	for i := range 500 {
+		cfg := Hw_config{Name: fmt.Sprintf("config-%d", i), Priority: rng.Intn(10)}
+
+		groups := 1
+		if i%25 == 0 {
+			groups = 2
+		}
+		for range groups {
+			group := new_hw_config_ids()
+			group.Hw.Class_ids = []string{"0300", "0302"}
+			group.Hw.Vendor_ids = []string{test_vendors[rng.Intn(len(test_vendors))]}
+
+			switch {
+			case i%50 == 0:
+				group.Hw.Vendor_ids = []string{"*"}
+				group.Hw.Device_ids = []string{"*"}
+				group.Blacklist.Device_ids = ids(20)
+			case i%10 == 0:
+				group.Hw.Device_ids = []string{"*"}
+			case i%3 == 0:
+				group.Hw.Device_ids = ids(3000)
+			default:
+				group.Hw.Device_ids = ids(1 + rng.Intn(50))
+			}
+
+			for _, list := range []*[]string{&group.Hw.Subvendor_ids, &group.Hw.Subdevice_ids,
+				&group.Blacklist.Class_ids, &group.Blacklist.Vendor_ids, &group.Blacklist.Subvendor_ids,
+				&group.Blacklist.Subdevice_ids} {
+				if len(*list) == 0 {
+					*list = []string{"*"}
+				}
+			}
+			cfg.Hw = append(cfg.Hw, group)
+		}
+
+		index_config_ids(&cfg)
+		configs = append(configs, cfg)
+	}
+	return configs
+}
+
+// Devices listed by the configs and unknown ones.
+func generate_test_devices(rng *rand.Rand, configs []Hw_config) []Hw_device {
+	var devices []Hw_device
+	for i := range 40 {
+		dev := Hw_device{Kind: Pci_kind, Class_id: "0300", Subvendor_id: "1043", Subdevice_id: "15a0",
+			Vendor_id: test_vendors[rng.Intn(len(test_vendors))], Device_id: fmt.Sprintf("%04x", rng.Intn(0x10000))}
+		if i%2 == 0 {
+			ids := &configs[rng.Intn(len(configs))].Hw[0].Hw
+			dev.Vendor_id = ids.Vendor_ids[0]
+			if ids.Device_ids[0] != "*" {
+				dev.Device_id = ids.Device_ids[rng.Intn(len(ids.Device_ids))]
+			}
+		}
+		devices = append(devices, dev)
+	}
+	return devices
+}
+
+func TestSetMatchingConfigs(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	configs := generate_test_configs(rng)
+	devices := generate_test_devices(rng, configs)
+
+	set_matching_configs(&devices, &configs, nil, false)
+
+	// Matching every device against every config gives the same result
+	expected := slices.Clone(devices)
+	for i := range expected {
+		expected[i].Available_configs = nil
+	}
+	for i := range configs {
+		for _, dev := range get_devices_of_config(&expected, &configs[i]) {
+			add_config_sorted(&dev.Available_configs, &configs[i])
+		}
+	}
+
+	matches := 0
+	for i := range devices {
+		var actual, wanted []string
+		for _, cfg := range devices[i].Available_configs {
+			actual = append(actual, cfg.Name)
+		}
+		for _, cfg := range expected[i].Available_configs {
+			wanted = append(wanted, cfg.Name)
+		}
+		if !slices.Equal(actual, wanted) {
+			t.Errorf("device %s:%s: expected %v, got %v", devices[i].Vendor_id, devices[i].Device_id, wanted, actual)
+		}
+		matches += len(actual)
+	}
+	if matches == 0 {
+		t.Error("no device matched a config")
+	}
+}
+
+func BenchmarkSetMatchingConfigs(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	configs := generate_test_configs(rng)
+	devices := generate_test_devices(rng, configs)
+	index := new_hw_config_index(configs)
+
+	clear_configs := func() {
+		for i := range devices {
+			devices[i].Available_configs = nil
+		}
+	}
+
+	b.Run("index", func(b *testing.B) {
+		for range b.N {
+			clear_configs()
+			set_matching_configs(&devices, &configs, index, false)
+		}
+	})
+
+	// Every config against every device, as before the inverted index
+	b.Run("scan", func(b *testing.B) {
+		for range b.N {
+			clear_configs()
+			for i := range configs {
+				for _, dev := range get_devices_of_config(&devices, &configs[i]) {
+					add_config_sorted(&dev.Available_configs, &configs[i])
+				}
+			}
+		}
+	})
+}
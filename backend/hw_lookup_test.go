@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var test_lookup_configs = map[string]string{
+	"video-any-class": `NAME="video-any-class"
+CLASSIDS="*"
+VENDORIDS="1002"
+DEVICEIDS="*"
+BLACKLISTEDCLASSIDS="0380"
+`,
+	"video-nvidia": `NAME="video-nvidia"
+PRIORITY="2"
+CLASSIDS="0300 0302"
+VENDORIDS="10de"
+DEVICEIDS="1c8d"
+`,
+	"video-hybrid-intel-nvidia": `NAME="video-hybrid-intel-nvidia"
+PRIORITY="4"
+CLASSIDS="0300"
+VENDORIDS="8086"
+DEVICEIDS="*"
+
+CLASSIDS="0300 0302"
+VENDORIDS="10de"
+DEVICEIDS="1c8d"
+`,
+}
+
+func TestFindConfigsForIds(t *testing.T) {
+	saved_mgr, saved_root := Hwmgr, hw_root
+	defer func() { Hwmgr, hw_root = saved_mgr, saved_root }()
+
+	hw_root = t.TempDir()
+	Hwmgr = Hw_manager{}
+	for name, config := range test_lookup_configs {
+		path := filepath.Join(hw_path(hw_mhwd_cfg_dir), "pci", "graphic_drivers", name, hw_mhwd_cfg_name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	Update_configs()
+
+	for _, test := range []struct {
+		query    string
+		expected []Hw_config_match
+	}{
+		// Any class that is not blacklisted
+		{"1002:73bf", []Hw_config_match{{Config: "video-any-class", Group: 1, Groups: 1}}},
+		{"1002:73bf:0300", []Hw_config_match{{Config: "video-any-class", Group: 1, Groups: 1}}},
+		{"1002:73bf:0380", nil},
+		// The hybrid config matches with its second group, the higher priority first
+		{"10de:1c8d", []Hw_config_match{{Config: "video-hybrid-intel-nvidia", Group: 2, Groups: 2},
+			{Config: "video-nvidia", Group: 1, Groups: 1}}},
+		{"8086:3e9b:0300", []Hw_config_match{{Config: "video-hybrid-intel-nvidia", Group: 1, Groups: 2}}},
+		{"8086:3e9b:0200", nil},
+	} {
+		matches, err := Find_configs_for_ids(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if len(matches) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.query, test.expected, matches)
+			continue
+		}
+		for i, match := range matches {
+			expected := test.expected[i]
+			if match.Config != expected.Config || match.Group != expected.Group || match.Groups != expected.Groups {
+				t.Errorf("%s: expected %v, got %v", test.query, expected, match)
+			}
+		}
+	}
+
+	for _, query := range []string{"10de", "10de:1c8d:0300:00", "10de:1c8", "10de:xyzw"} {
+		if _, err := Find_configs_for_ids(query); err == nil {
+			t.Errorf("%s: expected an error", query)
+		}
+	}
+}
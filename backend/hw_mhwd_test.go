@@ -0,0 +1,128 @@
+package backend
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+const test_config = `NAME="video-test"
+INFO="Test driver"
+VERSION="2024.01.01"
+FREEDRIVER="true"
+PRIORITY="1"
+
+CLASSIDS="0300"
+VENDORIDS="10de"
+DEVICEIDS="1c8d"
+
+DEPENDS="test-driver"
+`
+
+// Sets up a temporary root with a config database, the mhwd script and one matching device.
+// Package manager and script calls are recorded instead of run, other commands are run as is.
+func setup_test_root(t *testing.T) *[][]string {
+	saved_mgr, saved_root, saved_run_cmd, saved_sync := Hwmgr, hw_root, hw_run_cmd, hw_sync_pm_db
+	t.Cleanup(func() {
+		Hwmgr, hw_root, hw_run_cmd, hw_sync_pm_db = saved_mgr, saved_root, saved_run_cmd, saved_sync
+	})
+
+	hw_root = t.TempDir()
+	hw_sync_pm_db = true
+
+	config_dir := hw_path(filepath.Join(hw_mhwd_cfg_dir, "pci", "graphic_drivers", "video-test"))
+	if err := os.MkdirAll(config_dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(config_dir, hw_mhwd_cfg_name), []byte(test_config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(hw_path(hw_mhwd_script_path)), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hw_path(hw_mhwd_script_path), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	calls := &[][]string{}
+	hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+		if name == "pkexec" {
+			name, args = args[0], args[1:]
+		}
+		if name == "pacman" || name == hw_path(hw_mhwd_script_path) {
+			*calls = append(*calls, append([]string{name}, args...))
+			return nil
+		}
+		cmd := exec.Command(name, args...)
+		cmd.Stdout = output
+		return cmd.Run()
+	}
+
+	Hwmgr = Hw_manager{Pci_devices: []Hw_device{{Kind: Pci_kind, Class_id: "0300", Vendor_id: "10de",
+		Device_id: "1c8d", Sysfs_bus_id: "0000:01:00.0"}}}
+	Update_configs()
+
+	return calls
+}
+
+func TestInstallRemoveConfig(t *testing.T) {
+	calls := setup_test_root(t)
+	script := hw_path(hw_mhwd_script_path)
+
+	if err := install_config(Pci_kind, "video-test"); err != nil {
+		t.Fatal("install failed:", err)
+	}
+	if find_config(&Hwmgr.Installed_pci_configs, "video-test") == nil {
+		t.Fatal("config is not installed")
+	}
+
+	var install []string
+	for _, call := range *calls {
+		if call[0] == "pacman" && slices.Contains(call, "-S") {
+			t.Error("packages installed outside of the mhwd script:", call)
+		}
+		if call[0] == script {
+			install = call
+		}
+	}
+	if install == nil {
+		t.Fatal("mhwd script not run")
+	}
+	if !slices.Contains(install, "--install") || !slices.Contains(install, "--sync") {
+		t.Error("expected --install --sync, got", install)
+	}
+	if i := slices.Index(install, "--device"); i < 0 || install[i+1] != "0300|10de|1c8d|1:0:0" {
+		t.Error("expected the device with its Xorg bus id, got", install)
+	}
+
+	*calls = nil
+	if err := remove_config(Pci_kind, "video-test"); err != nil {
+		t.Fatal("remove failed:", err)
+	}
+	if len(Hwmgr.Installed_pci_configs) != 0 {
+		t.Error("config is still installed")
+	}
+	if _, err := os.Stat(filepath.Join(hw_path(hw_mhwd_pci_db_dir), "video-test")); !os.IsNotExist(err) {
+		t.Error("config is still in the database")
+	}
+	if !slices.ContainsFunc(*calls, func(call []string) bool {
+		return call[0] == script && call[1] == "--remove"
+	}) {
+		t.Error("expected the mhwd script to run with --remove, got", *calls)
+	}
+}
+
+func TestGetXorgBusId(t *testing.T) {
+	for bus_id, expected := range map[string]string{
+		"0000:01:00.0": "1:0:0",
+		"0000:0a:1f.7": "10:31:7",
+		"1-7:1.0":      "1-7:1.0",
+	} {
+		if actual := get_xorg_bus_id(bus_id); actual != expected {
+			t.Errorf("%s: expected %s, got %s", bus_id, expected, actual)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package backend
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Kernel with the NVIDIA module packages of both driver branches
+var test_kernels = recommend_kernels{running: "linux66", packages: map[string]string{
+	"linux66": "6.6.30-1", "linux66-nvidia": "550.78-1", "linux66-nvidia-470xx": "470.239.06-1"}}
+
+func find_test_device(t *testing.T, bus_id string) *Hw_device {
+	for i := range Hwmgr.Pci_devices {
+		if Hwmgr.Pci_devices[i].Sysfs_bus_id == bus_id {
+			return &Hwmgr.Pci_devices[i]
+		}
+	}
+	t.Fatal("no such device", bus_id)
+	return nil
+}
+
+func has_reason(rec Hw_recommendation, prefix string) bool {
+	return slices.ContainsFunc(rec.Reasons, func(reason string) bool {
+		return strings.HasPrefix(reason, prefix)
+	})
+}
+
+func TestRecommendHybrid(t *testing.T) {
+	load_test_fixture(t, "optimus-laptop")
+	nvidia := find_test_device(t, "0000:01:00.0")
+
+	ctx := new_recommend_context(Pci_kind, false, test_kernels)
+	if rec := ctx.recommend(nvidia); rec.Config != "video-hybrid-intel-nvidia-prime" {
+		t.Error("expected the hybrid config, got", rec.Config, rec.Reasons)
+	}
+
+	// A single GPU config of higher priority is skipped for the hybrid config
+	hybrid := nvidia.Available_configs[0]
+	nvidia.Available_configs = append(slices.Clone(nvidia.Available_configs[1:2]),
+		append([]*Hw_config{hybrid}, nvidia.Available_configs[2:]...)...)
+	rec := ctx.recommend(nvidia)
+	if rec.Config != "video-hybrid-intel-nvidia-prime" {
+		t.Error("expected the hybrid config, got", rec.Config, rec.Reasons)
+	}
+	if !has_reason(rec, "skipped video-nvidia (priority 8): hybrid graphics detected") {
+		t.Error("expected video-nvidia skipped for the hybrid config, got", rec.Reasons)
+	}
+
+	ctx = new_recommend_context(Pci_kind, true, test_kernels)
+	if rec := ctx.recommend(nvidia); rec.Config != "video-linux" {
+		t.Error("expected the open-source config, got", rec.Config, rec.Reasons)
+	}
+}
+
+func TestRecommendKernelModules(t *testing.T) {
+	load_test_fixture(t, "optimus-laptop")
+
+	// Only the NVIDIA GPU, without hybrid graphics
+	Hwmgr.Pci_devices = slices.DeleteFunc(Hwmgr.Pci_devices, func(dev Hw_device) bool {
+		return dev.Vendor_id != "10de"
+	})
+	Update_configs()
+	nvidia := find_test_device(t, "0000:01:00.0")
+
+	ctx := new_recommend_context(Pci_kind, false, test_kernels)
+	if rec := ctx.recommend(nvidia); rec.Config != "video-nvidia" {
+		t.Error("expected video-nvidia, got", rec.Config, rec.Reasons)
+	}
+
+	// No module packages for the running kernel
+	ctx = new_recommend_context(Pci_kind, false, recommend_kernels{running: "linux612",
+		packages: map[string]string{"linux612": "6.12.1-1"}})
+	rec := ctx.recommend(nvidia)
+	if rec.Config != "video-linux" {
+		t.Error("expected video-linux, got", rec.Config, rec.Reasons)
+	}
+	for _, reason := range []string{
+		"skipped video-nvidia (priority 8): no linux612-nvidia package",
+		"skipped video-nvidia-470xx (priority 6): no linux612-nvidia-470xx package",
+	} {
+		if !has_reason(rec, reason) {
+			t.Error("expected", reason, "got", rec.Reasons)
+		}
+	}
+
+	// Unknown running kernel, modules are not considered
+	ctx = new_recommend_context(Pci_kind, false, recommend_kernels{})
+	if rec := ctx.recommend(nvidia); rec.Config != "video-nvidia" {
+		t.Error("expected video-nvidia, got", rec.Config, rec.Reasons)
+	}
+}
+
+func TestRecommendBlacklistExclusions(t *testing.T) {
+	load_test_fixture(t, "macbook-bcm4331")
+
+	ctx := new_recommend_context(Pci_kind, false, test_kernels)
+	rec := ctx.recommend(find_test_device(t, "0000:02:00.0"))
+	if rec.Config != "" {
+		t.Error("expected no config, got", rec.Config)
+	}
+	if !has_reason(rec, "excluded network-broadcom-wl: 4331 is in BLACKLISTEDDEVICEIDS of ID group 1") {
+		t.Error("expected the blacklist exclusion, got", rec.Reasons)
+	}
+
+	load_test_fixture(t, "rtl8821ce-subsystems")
+	ctx = new_recommend_context(Pci_kind, false, test_kernels)
+	rec = ctx.recommend(find_test_device(t, "0000:03:00.0"))
+	for _, reason := range []string{
+		"excluded network-rtl8821ce-oem: 831a is in BLACKLISTEDSUBDEVICEIDS",
+		"excluded network-rtl8821ce: 103c is in BLACKLISTEDSUBVENDORIDS",
+	} {
+		if !has_reason(rec, reason) {
+			t.Error("expected", reason, "got", rec.Reasons)
+		}
+	}
+}
+
+func TestKernelModuleConfigRegex(t *testing.T) {
+	for name, expected := range map[string]string{
+		"video-nvidia":                    "nvidia",
+		"video-nvidia-470xx":              "nvidia-470xx",
+		"video-nvidia-390xx":              "nvidia-390xx",
+		"video-hybrid-intel-nvidia-prime": "",
+		"video-nvidia-open":               "",
+		"video-linux":                     "",
+	} {
+		actual := ""
+		if matches := hw_kernel_module_config_regex.FindStringSubmatch(name); matches != nil {
+			actual = matches[1]
+		}
+		if actual != expected {
+			t.Errorf("%s: expected %q, got %q", name, expected, actual)
+		}
+	}
+}
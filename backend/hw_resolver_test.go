@@ -0,0 +1,79 @@
+package backend
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Sets up the configs of the database and the installed ones by name.
+func setup_test_configs(t *testing.T, all []Hw_config, installed ...string) {
+	saved_mgr := Hwmgr
+	t.Cleanup(func() { Hwmgr = saved_mgr })
+
+	Hwmgr = Hw_manager{All_pci_configs: all}
+	for _, name := range installed {
+		Hwmgr.Installed_pci_configs = append(Hwmgr.Installed_pci_configs, *find_config(&all, name))
+	}
+}
+
+func TestResolveCycles(t *testing.T) {
+	setup_test_configs(t, []Hw_config{
+		{Name: "video-a", Dependencies: []string{"video-b"}},
+		{Name: "video-b", Dependencies: []string{"video-a"}},
+		{Name: "video-c", Dependencies: []string{"video-d"}},
+		{Name: "video-d", Dependencies: []string{"video-c"}},
+	}, "video-c", "video-d")
+
+	plan := resolve_install(Pci_kind, "video-a")
+	if len(plan.Errors) != 1 || !strings.Contains(plan.Errors[0], "video-a -> video-b -> video-a") {
+		t.Error("expected the dependency cycle as error, got", plan.Errors)
+	}
+
+	plan = resolve_remove(Pci_kind, "video-c")
+	if len(plan.Errors) != 1 || !strings.Contains(plan.Errors[0], "video-c -> video-d -> video-c") {
+		t.Error("expected the requirement cycle as error, got", plan.Errors)
+	}
+}
+
+func TestResolveInstallReplacesConflicts(t *testing.T) {
+	setup_test_configs(t, []Hw_config{
+		{Name: "video-nvidia", Conflicts: []string{"video-linux"}, Dependencies: []string{"video-base"}},
+		{Name: "video-linux"},
+		{Name: "video-linux-extra", Dependencies: []string{"video-linux"}},
+		{Name: "video-base"},
+	}, "video-linux", "video-linux-extra")
+
+	plan := resolve_install(Pci_kind, "video-nvidia")
+	if len(plan.Errors) != 0 {
+		t.Fatal("unexpected errors:", plan.Errors)
+	}
+	if !slices.Equal(plan.Remove, []string{"video-linux-extra", "video-linux"}) {
+		t.Error("expected the conflict and its requirement removed first, got", plan.Remove)
+	}
+	if !slices.Equal(plan.Install, []string{"video-base", "video-nvidia"}) {
+		t.Error("expected the dependency installed first, got", plan.Install)
+	}
+	if len(plan.Conflicts) != 1 {
+		t.Error("expected the conflict reported, got", plan.Conflicts)
+	}
+}
+
+func TestResolveRemoveDependents(t *testing.T) {
+	setup_test_configs(t, []Hw_config{
+		{Name: "video-base"},
+		{Name: "video-nvidia", Dependencies: []string{"video-base"}},
+		{Name: "video-nvidia-prime", Dependencies: []string{"video-nvidia"}},
+	}, "video-base", "video-nvidia", "video-nvidia-prime")
+
+	plan := resolve_remove(Pci_kind, "video-base")
+	if len(plan.Errors) != 0 {
+		t.Fatal("unexpected errors:", plan.Errors)
+	}
+	if !slices.Equal(plan.Remove, []string{"video-nvidia-prime", "video-nvidia", "video-base"}) {
+		t.Error("expected the dependents removed first, got", plan.Remove)
+	}
+	if len(plan.Conflicts) != 2 {
+		t.Error("expected the requirements reported, got", plan.Conflicts)
+	}
+}
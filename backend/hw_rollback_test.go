@@ -0,0 +1,47 @@
+package backend
+
+import (
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func TestRollbackRemovesOnlyConfigPackages(t *testing.T) {
+	calls := setup_test_root(t)
+	script := hw_path(hw_mhwd_script_path)
+
+	// The script installs the package of the config and fails, meanwhile another operation
+	// installed an unrelated package
+	installed := ""
+	hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+		if name == "pkexec" {
+			name, args = args[0], args[1:]
+		}
+		*calls = append(*calls, append([]string{name}, args...))
+		if name == script {
+			installed = "test-driver\nlinux612-headers\n"
+			return errors.New("post_install failed")
+		}
+		if name == "pacman" && slices.Contains(args, "-Qq") && output != nil {
+			io.WriteString(output, installed)
+		}
+		return nil
+	}
+
+	result := get_transaction_result(install_config(Pci_kind, "video-test"))
+	if result.Ok || !result.Rolled_back || result.Error == "" {
+		t.Errorf("expected a failed and rolled back transaction, got %+v", result)
+	}
+
+	var removals [][]string
+	for _, call := range *calls {
+		if call[0] == "pacman" && slices.Contains(call, "-Rns") {
+			removals = append(removals, call)
+		}
+	}
+	if len(removals) != 1 || !slices.Contains(removals[0], "test-driver") ||
+		slices.Contains(removals[0], "linux612-headers") {
+		t.Error("expected only the package of the config removed, got", removals)
+	}
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestRunTransactionProcess(t *testing.T) {
+	saved_mgr, saved_run_cmd, saved_sync := Hwmgr, hw_run_cmd, hw_sync_pm_db
+	defer func() { Hwmgr, hw_run_cmd, hw_sync_pm_db = saved_mgr, saved_run_cmd, saved_sync }()
+
+	Hwmgr = Hw_manager{Config_dirs: []string{"/tmp/configs"}}
+	hw_sync_pm_db = true
+
+	// The whole transaction is one pkexec call, which reports its result as the last line
+	var calls [][]string
+	var request Hw_transaction_request
+	hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		if name != "pkexec" || len(args) != 3 || args[1] != "hw-transaction" {
+			return errors.New("unexpected command")
+		}
+		if err := json.Unmarshal([]byte(args[2]), &request); err != nil {
+			return err
+		}
+		io.WriteString(output, "> Installing video-test...\n")
+		io.WriteString(output, hw_transaction_result_prefix+`{"Ok":false,"Error":"post_install failed","Rolled_back":true}`)
+		return errors.New("exit status 1")
+	}
+
+	result := run_transaction_process(Hw_transaction_request{Op: "install", Kind: Pci_kind, Name: "video-test"})
+	if len(calls) != 1 {
+		t.Error("expected one privileged call, got", calls)
+	}
+	if request.Op != "install" || request.Name != "video-test" || !request.Sync_pm_db ||
+		len(request.Config_dirs) != 1 {
+		t.Errorf("expected the request with the application state, got %+v", request)
+	}
+	if result.Ok || !result.Rolled_back || result.Error != "post_install failed" {
+		t.Errorf("expected the result of the process, got %+v", result)
+	}
+
+	// Cancelled authentication, pkexec exits without running the process
+	hw_run_cmd = func(output io.Writer, name string, args ...string) error {
+		return errors.New("exit status 126")
+	}
+	result = run_transaction_process(Hw_transaction_request{Op: "install", Kind: Pci_kind, Name: "video-test"})
+	if result.Ok || result.Rolled_back || result.Error == "" {
+		t.Errorf("expected a failed transaction, got %+v", result)
+	}
+}
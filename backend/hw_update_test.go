@@ -0,0 +1,51 @@
+package backend
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	for _, test := range []struct {
+		a, b     string
+		expected int
+	}{
+		{"2023.01.10", "2023.1.9", 1},
+		{"2023.09.12", "2023.09.12", 0},
+		// Numeric segments compare by value, not as text
+		{"2023.09.12", "2023.9.12", 0},
+		{"2023.10.01", "2023.9.30", 1},
+		{"1.2.3-1", "1.2.3-2", -1},
+		{"1.0", "1.0.1", -1},
+		// Alphabetic segments are older than numeric ones
+		{"1.0.rc1", "1.0.1", -1},
+		{"1.0beta", "1.0", -1},
+		{"1.0.alpha", "1.0.beta", -1},
+		{"", "2023.01.01", -1},
+	} {
+		if actual := compare_versions(test.a, test.b); actual != test.expected {
+			t.Errorf("%q vs %q: expected %d, got %d", test.a, test.b, test.expected, actual)
+		}
+		if actual := compare_versions(test.b, test.a); actual != -test.expected {
+			t.Errorf("%q vs %q: expected %d, got %d", test.b, test.a, -test.expected, actual)
+		}
+	}
+}
+
+func TestSetConfigUpdates(t *testing.T) {
+	setup_test_configs(t, []Hw_config{
+		{Name: "video-nvidia", Version: "2023.01.10"},
+		{Name: "video-linux", Version: "2023.09.12"},
+		{Name: "video-vesa", Version: "2023.1.1"},
+	}, "video-nvidia", "video-linux", "video-vesa")
+
+	// Installed versions differ from the database
+	Hwmgr.Installed_pci_configs[0].Version = "2023.1.9"
+	Hwmgr.Installed_pci_configs[2].Version = "2024.01.01"
+
+	set_config_updates(Pci_kind)
+
+	for i, expected := range []string{"2023.01.10", "", ""} {
+		cfg := Hwmgr.Installed_pci_configs[i]
+		if cfg.Update_version != expected {
+			t.Errorf("%s %s: expected update %q, got %q", cfg.Name, cfg.Version, expected, cfg.Update_version)
+		}
+	}
+}
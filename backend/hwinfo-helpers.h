@@ -6,9 +6,6 @@
 #include <malloc.h>
 #include <stdio.h>
 
-typedef struct {
-} hw_manager;
-
 typedef enum {
     HWUSB = 0,
     HWPCI,
@@ -1,7 +1,6 @@
 package backend
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
@@ -217,52 +216,12 @@ func pacman_install_remove_kernel(name string, install bool) {
 		return
 	}
 
-	// Prepare the command
-	args := append([]string{"/usr/bin/pacman", "--noconfirm", "--noprogressbar", op, name}, kernel.Installed_modules...)
-	cmd := exec.Command("pkexec", args...)
-	cmd.Env = append(cmd.Env, "LANG=C", "LC_MESSAGES=C")
-
-	// Get a pipe to stdout
-	stdout_pipe, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Println("error: failed to create stdout pipe:", err)
-		Krlmgr.App.EmitEvent("kernelOpFinished", false)
-		return
-	}
-
 	log.Println("start kernel", name, op_long)
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		log.Println("error: failed to start command:", err)
-		Krlmgr.App.EmitEvent("kernelOpFinished", false)
-		return
+	args := append([]string{op, name}, kernel.Installed_modules...)
+	if !pkexec_pacman(Krlmgr.App, "kernelOp", args) {
+		log.Println("error: failed to", op_long, "kernel", name)
 	}
-
-	// Continuously capture the output
-	var output string
-	scanner := bufio.NewScanner(stdout_pipe)
-	for scanner.Scan() {
-		line := scanner.Text()
-		output += line + "\n" // Append each line to the output string
-
-		// Emit a signal for each new line of output
-		Krlmgr.App.EmitEvent("kernelOpOutputLine", line)
-		log.Println(line)
-	}
-
-	if err := scanner.Err(); err != nil {
-		log.Println("error: reading command output:", err)
-	}
-
-	// Wait for the command to finish
-	err = cmd.Wait()
-	if err != nil {
-		log.Println("error: failed to", op_long, "kernel:", err)
-	}
-
-	// Emit the event only after the command finishes
-	Krlmgr.App.EmitEvent("kernelOpFinished", err == nil)
 }
 
 func get_available_packages() map[string]string {
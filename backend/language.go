@@ -1,10 +1,13 @@
 package backend
 
 import (
+	"bufio"
 	_ "embed"
 	"encoding/json"
 	"log"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
@@ -24,10 +27,36 @@ type Language_package struct {
 	Parent_pkgs_installed []string
 	Installed             []string
 	Available             []string
+
+	// Packages of the system locales
+	Locales []Language_pack_locale
+	// Packages of the system locales to install, if a parent package is installed
+	Missing []string
+}
+
+// State of a Language_package for one locale of the system.
+type Language_pack_locale struct {
+	Locale string
+	// Package for the locale, "" if no variant is available
+	Required  string
+	Installed bool
+	Missing   bool
+}
+
+// Selects the language packs of an install or remove operation.
+type Language_pack_request struct {
+	// Name of the Language_package, all with an installed parent package if empty
+	Name string
+	// Locale like "de_DE.UTF-8", the locales of the system if empty
+	Locale string
 }
 
 var Lngmgr Language_manager
 
+const locale_conf_path = "/etc/locale.conf"
+const locale_gen_path = "/etc/locale.gen"
+const locale_supported_path = "/usr/share/i18n/SUPPORTED"
+
 // Reads installed packages using `pacman -Qq`
 func installed_packages() []string {
 	cmd := exec.Command("pacman", "-Qq")
@@ -83,28 +112,50 @@ func intersect(packages1, packages2 []string) []string {
 	return result
 }
 
-// Filters language packages by prefix match
-func filter_pkg(pkg string, packages []string) []string {
-	pkg_name := pkg
-	if strings.Contains(pkg, "%") {
-		pkg_name = pkg[:strings.Index(pkg, "%")]
+// returns the locale variants of the language package pattern, only packages whose "%" part is
+// one of the locale codes, so "libreoffice-still-sdk" isn't taken for a language pack
+func filter_pkg(pkg string, packages []string, codes map[string]bool) []string {
+	prefix, suffix, found := strings.Cut(pkg, "%")
+	if !found {
+		return intersect([]string{pkg}, packages)
 	}
 
 	var result []string
 	for _, p := range packages {
-		if strings.HasPrefix(p, pkg_name) {
+		if len(p) <= len(prefix)+len(suffix) || !strings.HasPrefix(p, prefix) || !strings.HasSuffix(p, suffix) {
+			continue
+		}
+		if codes[p[len(prefix):len(p)-len(suffix)]] {
 			result = append(result, p)
 		}
 	}
 	return result
 }
 
+// returns the package suffixes of the locales glibc supports and of the locales of the system
+func get_all_locale_codes(locales []string) map[string]bool {
+	codes := make(map[string]bool)
+	// "de_DE.UTF-8 UTF-8"
+	for _, line := range read_locale_file(locale_supported_path) {
+		for _, code := range get_locale_codes(strings.Fields(line)[0]) {
+			codes[code] = true
+		}
+	}
+	for _, locale := range locales {
+		for _, code := range get_locale_codes(locale) {
+			codes[code] = true
+		}
+	}
+	return codes
+}
+
 // Main logic to process language packages
 func Get_language_packs() []Language_package {
 	installed_pkg := installed_packages()
 	available_pkg := available_packages()
 
-	log.Println("XXX Get_language_packs")
+	locales := get_system_locales()
+	codes := get_all_locale_codes(locales)
 
 	var json_object map[string]interface{}
 	if err := json.Unmarshal(language_packages_json, &json_object); err != nil {
@@ -131,8 +182,8 @@ func Get_language_packs() []Language_package {
 		}
 
 		parent_pkgs_installed := intersect(parent_pkgs, installed_pkg)
-		pkg_installed := filter_pkg(pkg, installed_pkg)
-		pkg_available := filter_pkg(pkg, available_pkg)
+		pkg_installed := filter_pkg(pkg, installed_pkg, codes)
+		pkg_available := filter_pkg(pkg, available_pkg, codes)
 
 		lp := Language_package{
 			Name:                  name,
@@ -142,8 +193,201 @@ func Get_language_packs() []Language_package {
 			Installed:             pkg_installed,
 			Available:             pkg_available,
 		}
+		set_language_pack_locales(&lp, locales)
 		lp_list = append(lp_list, lp)
 	}
 
 	return lp_list
 }
+
+// Installs the language packs of the request for the locales, with progress as languageOp events.
+func (mgr *Language_manager) Install_language_packs(request Language_pack_request) bool {
+	return pacman_install_remove_language_packs(request, true)
+}
+
+func (mgr *Language_manager) Remove_language_packs(request Language_pack_request) bool {
+	return pacman_install_remove_language_packs(request, false)
+}
+
+// Installs the missing language packs of all installed applications for the system locales.
+func (mgr *Language_manager) Install_missing_language_packs() bool {
+	return pacman_install_remove_language_packs(Language_pack_request{}, true)
+}
+
+func pacman_install_remove_language_packs(request Language_pack_request, install bool) bool {
+	op := []string{"-S", "--needed"}
+	op_long := "install"
+	if !install {
+		op = []string{"-R"}
+		op_long = "remove"
+	}
+
+	pkgs := get_language_pack_targets(Get_language_packs(), request, install)
+	if len(pkgs) == 0 {
+		log.Println("nothing to", op_long, "for language packs", request)
+		Lngmgr.App.EmitEvent("languageOpFinished", true)
+		return true
+	}
+
+	log.Println("start language packs", op_long, pkgs)
+
+	ok := pkexec_pacman(Lngmgr.App, "languageOp", append(op, pkgs...))
+	if !ok {
+		log.Println("error: failed to", op_long, "language packs", pkgs)
+	}
+
+	// Installed packages changed, also after a partial failure
+	Lngmgr.App.EmitEvent("languagePacksChanged", Get_language_packs())
+	return ok
+}
+
+// returns the packages to install or remove for the request
+func get_language_pack_targets(packs []Language_package, request Language_pack_request, install bool) []string {
+	var pkgs []string
+	for _, lp := range packs {
+		if request.Name != "" && lp.Name != request.Name {
+			continue
+		}
+		// Without a name only the applications on the system are handled
+		if request.Name == "" && len(lp.Parent_pkgs_installed) == 0 {
+			continue
+		}
+
+		// Without a locale the packages of the system locales are handled
+		if request.Locale == "" {
+			for _, locale := range lp.Locales {
+				if locale.Required != "" && locale.Installed != install {
+					pkgs = append(pkgs, locale.Required)
+				}
+			}
+		} else if install {
+			pkg := find_locale_package(lp.Pkg, request.Locale, lp.Available)
+			if pkg != "" && !slices.Contains(lp.Installed, pkg) {
+				pkgs = append(pkgs, pkg)
+			}
+		} else if pkg := find_locale_package(lp.Pkg, request.Locale, lp.Installed); pkg != "" {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+
+	slices.Sort(pkgs)
+	return slices.Compact(pkgs)
+}
+
+// Resolves the pattern of the package against the locales.
+func set_language_pack_locales(lp *Language_package, locales []string) {
+	for _, locale := range locales {
+		state := Language_pack_locale{Locale: locale}
+		state.Required = find_locale_package(lp.Pkg, locale, lp.Available)
+		if state.Required == "" {
+			// Installed from elsewhere or no longer in the repositories
+			state.Required = find_locale_package(lp.Pkg, locale, lp.Installed)
+		}
+		state.Installed = state.Required != "" && slices.Contains(lp.Installed, state.Required)
+		state.Missing = state.Required != "" && !state.Installed && len(lp.Parent_pkgs_installed) > 0
+
+		if state.Missing && !slices.Contains(lp.Missing, state.Required) {
+			lp.Missing = append(lp.Missing, state.Required)
+		}
+		lp.Locales = append(lp.Locales, state)
+	}
+}
+
+// returns the package of the pattern for the locale, "firefox-i18n-pt-br" for "firefox-i18n-%"
+// and "pt_BR.UTF-8", or "" if the packages don't contain it
+func find_locale_package(pattern, locale string, packages []string) string {
+	for _, code := range get_locale_codes(locale) {
+		pkg := strings.Replace(pattern, "%", code, 1)
+		if slices.Contains(packages, pkg) {
+			return pkg
+		}
+	}
+	return ""
+}
+
+// returns the package suffixes of the locale, the most specific first: "pt-br", "pt_br" and "pt"
+// for "pt_BR.UTF-8", as firefox-i18n-pt-br and hunspell-pt_br name them, so de_AT falls back to
+// de. Chinese has no fallback, "zh" would mix simplified and traditional script, zh_TW only
+// gives "zh-tw" and "zh_tw"
+func get_locale_codes(locale string) []string {
+	locale = normalize_locale(locale)
+	if locale == "" {
+		return nil
+	}
+
+	lang, region, found := strings.Cut(strings.ToLower(locale), "_")
+	if !found {
+		return []string{lang}
+	}
+	codes := []string{lang + "-" + region, lang + "_" + region}
+	if lang == "zh" {
+		return codes
+	}
+	return append(codes, lang)
+}
+
+// returns the locale without encoding and modifier, "de_DE" for "de_DE.UTF-8@euro", or "" for
+// the C locale
+func normalize_locale(locale string) string {
+	locale, _, _ = strings.Cut(locale, ".")
+	locale, _, _ = strings.Cut(locale, "@")
+	if locale == "C" || locale == "POSIX" {
+		return ""
+	}
+	return locale
+}
+
+// returns the configured locales of /etc/locale.conf followed by the generated ones of
+// /etc/locale.gen, without duplicates
+func get_system_locales() []string {
+	var locales []string
+	add := func(locale string) {
+		locale = normalize_locale(strings.Trim(locale, "\"'"))
+		if locale != "" && !slices.Contains(locales, locale) {
+			locales = append(locales, locale)
+		}
+	}
+
+	for _, line := range read_locale_file(locale_conf_path) {
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "LANG", "LC_MESSAGES":
+			add(value)
+		case "LANGUAGE":
+			// Priority list like "de_AT:de:en"
+			for _, locale := range strings.Split(strings.Trim(value, "\"'"), ":") {
+				add(locale)
+			}
+		}
+	}
+
+	// "de_DE.UTF-8 UTF-8"
+	for _, line := range read_locale_file(locale_gen_path) {
+		add(strings.Fields(line)[0])
+	}
+
+	return locales
+}
+
+// returns the lines of the file without comments and blank lines
+func read_locale_file(path string) []string {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Println("error: failed to read", path+":", err)
+		return nil
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,92 @@
+package backend
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestGetLocaleCodes(t *testing.T) {
+	for locale, expected := range map[string][]string{
+		"pt_BR.UTF-8":      {"pt-br", "pt_br", "pt"},
+		"de_AT.UTF-8@euro": {"de-at", "de_at", "de"},
+		"zh_TW.UTF-8":      {"zh-tw", "zh_tw"},
+		"zh_CN":            {"zh-cn", "zh_cn"},
+		"en":               {"en"},
+		"C.UTF-8":          nil,
+	} {
+		if actual := get_locale_codes(locale); !slices.Equal(actual, expected) {
+			t.Errorf("%s: expected %v, got %v", locale, expected, actual)
+		}
+	}
+}
+
+func TestFilterPkg(t *testing.T) {
+	codes := get_all_locale_codes([]string{"de_DE.UTF-8", "en_GB.UTF-8", "en_US.UTF-8", "zh_CN.UTF-8"})
+	packages := []string{"libreoffice-still", "libreoffice-still-de", "libreoffice-still-en-gb",
+		"libreoffice-still-sdk", "libreoffice-still-sdk-doc", "psi-i18n", "hunspell", "hunspell-en_us",
+		"man-pages", "man-pages-zh_cn", "man-pages-zh"}
+
+	for pattern, expected := range map[string][]string{
+		"libreoffice-still-%": {"libreoffice-still-de", "libreoffice-still-en-gb"},
+		"hunspell-%":          {"hunspell-en_us"},
+		"man-pages-%":         {"man-pages-zh_cn"},
+	} {
+		if actual := filter_pkg(pattern, packages, codes); !slices.Equal(actual, expected) {
+			t.Errorf("%s: expected %v, got %v", pattern, expected, actual)
+		}
+	}
+	if actual := filter_pkg("psi-i18n", packages, codes); !slices.Equal(actual, []string{"psi-i18n"}) {
+		t.Errorf("expected [psi-i18n], got %v", actual)
+	}
+}
+
+func TestGetLanguagePackTargets(t *testing.T) {
+	lp := Language_package{
+		Name:                  "LibreOffice",
+		Pkg:                   "libreoffice-still-%",
+		Parent_pkgs_installed: []string{"libreoffice-still"},
+		Installed:             []string{"libreoffice-still-de", "libreoffice-still-fr"},
+		Available:             []string{"libreoffice-still-de", "libreoffice-still-fr", "libreoffice-still-pt-br"},
+	}
+	set_language_pack_locales(&lp, []string{"de_AT", "pt_BR"})
+
+	hunspell := Language_package{
+		Name:                  "Hunspell",
+		Pkg:                   "hunspell-%",
+		Parent_pkgs_installed: []string{"hunspell"},
+		Installed:             []string{"hunspell-de"},
+		Available:             []string{"hunspell-de", "hunspell-en_us"},
+	}
+	set_language_pack_locales(&hunspell, []string{"en_US", "de_DE"})
+
+	man_pages := Language_package{
+		Name:                  "Man Pages",
+		Pkg:                   "man-pages-%",
+		Parent_pkgs_installed: []string{"man-pages"},
+		Installed:             []string{"man-pages-zh_cn"},
+		Available:             []string{"man-pages-zh_cn", "man-pages-zh_tw"},
+	}
+	set_language_pack_locales(&man_pages, []string{"zh_CN"})
+
+	packs := []Language_package{lp, hunspell, man_pages}
+
+	for _, test := range []struct {
+		request  Language_pack_request
+		install  bool
+		expected []string
+	}{
+		{Language_pack_request{}, true, []string{"hunspell-en_us", "libreoffice-still-pt-br"}},
+		// Only the installed packages of the system locales, fr was installed on purpose
+		{Language_pack_request{}, false, []string{"hunspell-de", "libreoffice-still-de", "man-pages-zh_cn"}},
+		{Language_pack_request{Name: "Hunspell", Locale: "en_US.UTF-8"}, true, []string{"hunspell-en_us"}},
+		{Language_pack_request{Name: "Man Pages", Locale: "zh_TW.UTF-8"}, true, []string{"man-pages-zh_tw"}},
+		{Language_pack_request{Name: "LibreOffice", Locale: "fr_FR.UTF-8"}, false, []string{"libreoffice-still-fr"}},
+		{Language_pack_request{Name: "LibreOffice", Locale: "de_DE.UTF-8"}, true, nil},
+		{Language_pack_request{Name: "Firefox"}, true, nil},
+	} {
+		actual := get_language_pack_targets(packs, test.request, test.install)
+		if !slices.Equal(actual, test.expected) {
+			t.Errorf("%+v install %v: expected %v, got %v", test.request, test.install, test.expected, actual)
+		}
+	}
+}
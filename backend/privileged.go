@@ -0,0 +1,107 @@
+package backend
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/wailsapp/wails/v3/pkg/application"
+)
+
+// Runs pacman with the arguments through pkexec. Every line of output is emitted as
+// `<event>OutputLine`, the result as `<event>Finished` once the command has ended.
+func pkexec_pacman(app *application.App, event string, args []string) bool {
+	ok := run_pkexec_pacman(app, event, args)
+
+	// Emit the event only after the command finishes
+	app.EmitEvent(event+"Finished", ok)
+	return ok
+}
+
+func run_pkexec_pacman(app *application.App, event string, args []string) bool {
+	// Prepare the command
+	args = append([]string{"/usr/bin/pacman", "--noconfirm", "--noprogressbar"}, args...)
+	cmd := exec.Command("pkexec", args...)
+	cmd.Env = append(cmd.Env, "LANG=C", "LC_MESSAGES=C")
+
+	// Get a pipe to stdout
+	stdout_pipe, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Println("error: failed to create stdout pipe:", err)
+		return false
+	}
+
+	// Start the command
+	if err := cmd.Start(); err != nil {
+		log.Println("error: failed to start command:", err)
+		return false
+	}
+
+	// Continuously capture the output
+	scanner := bufio.NewScanner(stdout_pipe)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// Emit a signal for each new line of output
+		app.EmitEvent(event+"OutputLine", line)
+		log.Println(line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println("error: reading command output:", err)
+	}
+
+	// Wait for the command to finish
+	if err := cmd.Wait(); err != nil {
+		log.Println("error: pacman", args[3:], "failed:", err)
+		return false
+	}
+	return true
+}
+
+// Runs a command changing the system as root, through pkexec unless the application already
+// runs as root.
+func hw_run_privileged_cmd(output io.Writer, name string, args ...string) error {
+	if os.Geteuid() != 0 {
+		return hw_run_cmd(output, "pkexec", append([]string{name}, args...)...)
+	}
+	return hw_run_cmd(output, name, args...)
+}
+
+// Writes the file as root, creating missing parent directories.
+func write_privileged_file(path string, data []byte) error {
+	tmp, err := os.CreateTemp("", "mcp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if close_err := tmp.Close(); err == nil {
+		err = close_err
+	}
+	if err != nil {
+		return err
+	}
+
+	return hw_run_privileged_cmd(nil, "install", "-D", "-m", "0644", tmp.Name(), path)
+}
+
+// Removes the file or directory as root, a missing path is no error.
+func remove_privileged(path string) error {
+	return hw_run_privileged_cmd(nil, "rm", "-rf", path)
+}
+
+// Copies the directory as root, replacing an existing target.
+func copy_privileged_directory(src, dst string) error {
+	if err := remove_privileged(dst); err != nil {
+		return err
+	}
+	if err := hw_run_privileged_cmd(nil, "mkdir", "-p", filepath.Dir(dst)); err != nil {
+		return err
+	}
+	return hw_run_privileged_cmd(nil, "cp", "-r", src, dst)
+}
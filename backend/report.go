@@ -0,0 +1,234 @@
+package backend
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const report_redacted = "<redacted>"
+
+// Files identifying a bootloader, relative to the root.
+var report_bootloader_files = []struct {
+	name  string
+	paths []string
+}{
+	{"GRUB", []string{"/boot/grub/grub.cfg"}},
+	{"systemd-boot", []string{"/boot/loader/loader.conf", "/efi/loader/loader.conf", "/boot/efi/loader/loader.conf"}},
+	{"rEFInd", []string{"/boot/refind_linux.conf", "/boot/EFI/refind/refind.conf", "/boot/efi/EFI/refind/refind.conf"}},
+	{"Limine", []string{"/boot/limine.conf", "/boot/limine/limine.conf", "/boot/limine.cfg"}},
+}
+
+// Hardware and system state as needed by helpdesks, similar to inxi or mhwd -l -d.
+type Report struct {
+	Hostname       string
+	Kernel_release string
+	Boot_mode      string
+	Bootloaders    []string
+
+	Pci_devices, Usb_devices []Report_device
+	Kernels                  []Kernel
+	Language_packages        []Language_package
+}
+
+type Report_device struct {
+	Bus_id, Class_id, Vendor_id, Device_id string
+	Subvendor_id, Subdevice_id             string
+	Name, Driver, Serial                   string
+	Installed_configs, Available_configs   []string
+}
+
+// Collects the report. With redact, serial numbers and the hostname are left out.
+func Generate_report(redact bool) Report {
+	var report Report
+
+	report.Hostname, _ = os.Hostname()
+	if redact {
+		report.Hostname = report_redacted
+	}
+
+	report.Kernel_release = read_sysfs_string(hw_path(filepath.Dir(hw_kernel_release_path)),
+		filepath.Base(hw_kernel_release_path))
+
+	report.Boot_mode = "BIOS"
+	if _, err := os.Stat(hw_path("/sys/firmware/efi")); err == nil {
+		report.Boot_mode = "UEFI"
+	}
+
+	for _, bootloader := range report_bootloader_files {
+		for _, path := range bootloader.paths {
+			if _, err := os.Stat(hw_path(path)); err == nil {
+				report.Bootloaders = append(report.Bootloaders, bootloader.name)
+				break
+			}
+		}
+	}
+
+	report.Pci_devices = get_report_devices(Hwmgr.Pci_devices, redact)
+	report.Usb_devices = get_report_devices(Hwmgr.Usb_devices, redact)
+
+	for _, kernel := range Krlmgr.Get_kernels() {
+		if kernel.Installed || kernel.Running {
+			report.Kernels = append(report.Kernels, kernel)
+		}
+	}
+
+	// Only language packages for installed applications are of interest
+	for _, lp := range Get_language_packs() {
+		if len(lp.Parent_pkgs_installed) != 0 {
+			report.Language_packages = append(report.Language_packages, lp)
+		}
+	}
+
+	return report
+}
+
+func get_report_devices(devices []Hw_device, redact bool) []Report_device {
+	var report_devices []Report_device
+
+	for _, dev := range devices {
+		rdev := Report_device{
+			Bus_id:       dev.Sysfs_bus_id,
+			Class_id:     dev.Class_id,
+			Vendor_id:    dev.Vendor_id,
+			Device_id:    dev.Device_id,
+			Subvendor_id: dev.Subvendor_id,
+			Subdevice_id: dev.Subdevice_id,
+			Name:         strings.TrimSpace(dev.Vendor_name + " " + dev.Device_name),
+			Driver:       dev.Driver,
+			Serial:       dev.Serial,
+		}
+		if redact && rdev.Serial != "" {
+			rdev.Serial = report_redacted
+		}
+
+		for _, cfg := range dev.Installed_configs {
+			rdev.Installed_configs = append(rdev.Installed_configs, cfg.Name)
+		}
+		for _, cfg := range dev.Available_configs {
+			rdev.Available_configs = append(rdev.Available_configs, cfg.Name)
+		}
+
+		report_devices = append(report_devices, rdev)
+	}
+
+	return report_devices
+}
+
+func (report *Report) Text() string {
+	var text strings.Builder
+
+	fmt.Fprintf(&text, "Hostname: %s\n", report.Hostname)
+	fmt.Fprintf(&text, "Kernel: %s\n", report.Kernel_release)
+	fmt.Fprintf(&text, "Boot: %s, %s\n", report.Boot_mode, report.bootloaders())
+
+	for _, section := range []struct {
+		title   string
+		devices []Report_device
+	}{{"PCI devices", report.Pci_devices}, {"USB devices", report.Usb_devices}} {
+		fmt.Fprintf(&text, "\n%s:\n", section.title)
+		for _, dev := range section.devices {
+			fmt.Fprintf(&text, "  %s [%s] %s:%s %s\n", dev.Bus_id, dev.Class_id, dev.Vendor_id, dev.Device_id, dev.Name)
+			fmt.Fprintf(&text, "    driver: %s\n", or_none(dev.Driver))
+			if dev.Serial != "" {
+				fmt.Fprintf(&text, "    serial: %s\n", dev.Serial)
+			}
+			if len(dev.Installed_configs)+len(dev.Available_configs) != 0 {
+				fmt.Fprintf(&text, "    installed configs: %s\n", or_none(strings.Join(dev.Installed_configs, ", ")))
+				fmt.Fprintf(&text, "    available configs: %s\n", or_none(strings.Join(dev.Available_configs, ", ")))
+			}
+		}
+	}
+
+	fmt.Fprintf(&text, "\nKernels:\n")
+	for _, kernel := range report.Kernels {
+		fmt.Fprintf(&text, "  %s %s%s\n", kernel.Name, kernel.Version, kernel_state(&kernel))
+	}
+
+	fmt.Fprintf(&text, "\nLanguage packages:\n")
+	for _, lp := range report.Language_packages {
+		fmt.Fprintf(&text, "  %s: %s\n", lp.Name, or_none(strings.Join(lp.Installed, ", ")))
+	}
+
+	return text.String()
+}
+
+func (report *Report) Markdown() string {
+	var text strings.Builder
+
+	fmt.Fprintf(&text, "# System report\n\n")
+	fmt.Fprintf(&text, "- **Hostname:** %s\n", report.Hostname)
+	fmt.Fprintf(&text, "- **Kernel:** %s\n", report.Kernel_release)
+	fmt.Fprintf(&text, "- **Boot:** %s, %s\n", report.Boot_mode, report.bootloaders())
+
+	for _, section := range []struct {
+		title   string
+		devices []Report_device
+	}{{"PCI devices", report.Pci_devices}, {"USB devices", report.Usb_devices}} {
+		fmt.Fprintf(&text, "\n## %s\n\n", section.title)
+		fmt.Fprintf(&text, "| Bus ID | Class | IDs | Name | Driver | Serial | Installed configs | Available configs |\n")
+		fmt.Fprintf(&text, "|---|---|---|---|---|---|---|---|\n")
+		for _, dev := range section.devices {
+			fmt.Fprintf(&text, "| %s | %s | %s:%s | %s | %s | %s | %s | %s |\n", dev.Bus_id, dev.Class_id,
+				dev.Vendor_id, dev.Device_id, markdown_escape(dev.Name), dev.Driver, markdown_escape(dev.Serial),
+				strings.Join(dev.Installed_configs, ", "), strings.Join(dev.Available_configs, ", "))
+		}
+	}
+
+	fmt.Fprintf(&text, "\n## Kernels\n\n")
+	for _, kernel := range report.Kernels {
+		fmt.Fprintf(&text, "- %s %s%s\n", kernel.Name, kernel.Version, kernel_state(&kernel))
+	}
+
+	fmt.Fprintf(&text, "\n## Language packages\n\n")
+	for _, lp := range report.Language_packages {
+		fmt.Fprintf(&text, "- %s: %s\n", lp.Name, or_none(strings.Join(lp.Installed, ", ")))
+	}
+
+	return text.String()
+}
+
+func (report *Report) Json() string {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return "{}"
+	}
+	return string(data) + "\n"
+}
+
+func (report *Report) bootloaders() string {
+	if len(report.Bootloaders) == 0 {
+		return "unknown bootloader"
+	}
+	return strings.Join(report.Bootloaders, ", ")
+}
+
+func kernel_state(kernel *Kernel) string {
+	var states []string
+	if kernel.Running {
+		states = append(states, "running")
+	}
+	if kernel.Lts {
+		states = append(states, "LTS")
+	}
+	if kernel.Eol {
+		states = append(states, "EOL")
+	}
+	if len(states) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(states, ", ") + ")"
+}
+
+func or_none(str string) string {
+	if str == "" {
+		return "none"
+	}
+	return str
+}
+
+func markdown_escape(str string) string {
+	return strings.ReplaceAll(str, "|", "\\|")
+}
@@ -1,27 +1,243 @@
 package main
 
 import (
+	"log"
 	"manjaro-control-panel/backend"
+	"slices"
 )
 
+// Each call holds the lock of the hardware manager, hotplug rescans replace the devices and
+// configs concurrently.
 type HwService struct{}
 
 func (g *HwService) Devices() []backend.Hw_device {
-	return backend.Hwmgr.Pci_devices
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return slices.Clone(backend.Hwmgr.Pci_devices)
+}
+
+func (g *HwService) UsbDevices() []backend.Hw_device {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return slices.Clone(backend.Hwmgr.Usb_devices)
+}
+
+func (g *HwService) ConfigRoots() []string {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Get_config_roots()
+}
+
+func (g *HwService) InvalidConfigs() []backend.Hw_config {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return slices.Clone(backend.Hwmgr.Invalid_configs)
+}
+
+func (g *HwService) ConfigDiagnostics() []backend.Hw_config_diagnostic {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Get_config_diagnostics()
+}
+
+func (g *HwService) InstallConfig(name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Install_pci_config(name)
+}
+
+func (g *HwService) RemoveConfig(name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Remove_pci_config(name)
+}
+
+func (g *HwService) InstallUsbConfig(name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Install_usb_config(name)
+}
+
+func (g *HwService) RemoveUsbConfig(name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Remove_usb_config(name)
+}
+
+func (g *HwService) ConfigUpdates() []backend.Hw_config {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Get_config_updates()
+}
+
+func (g *HwService) UpdateConfig(kind backend.Hw_kind, name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Update_config(kind, name)
+}
+
+func (g *HwService) InstallPlan(kind backend.Hw_kind, name string) backend.Hw_plan {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Resolve_install(kind, name)
+}
+
+func (g *HwService) RemovePlan(kind backend.Hw_kind, name string) backend.Hw_plan {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Resolve_remove(kind, name)
+}
+
+func (g *HwService) ExecuteInstallPlan(kind backend.Hw_kind, name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Execute_plan(kind, name, true)
 }
 
-func (g *HwService) InstallConfig(name string) {
-	backend.Hwmgr.Install_pci_config(name)
+func (g *HwService) ExecuteRemovePlan(kind backend.Hw_kind, name string) backend.Hw_transaction_result {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Execute_plan(kind, name, false)
+}
+
+func (g *HwService) Recommendations(kind backend.Hw_kind, freeOnly bool) []backend.Hw_recommendation {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Recommend_configs(kind, freeOnly)
+}
+
+func (g *HwService) MissingFirmware() []backend.Hw_missing_firmware {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Get_missing_firmware()
+}
+
+func (g *HwService) InstallFirmware(packages []string) bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Install_firmware(packages)
+}
+
+func (g *HwService) GraphicsStatus() backend.Hw_graphics_status {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Get_graphics_status()
+}
+
+// Fails on a malformed query, no matches mean that no config supports the IDs.
+func (g *HwService) ConfigsForIds(query string) ([]backend.Hw_config_match, error) {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Find_configs_for_ids(query)
+}
+
+func (g *HwService) HybridGraphics() backend.Hw_hybrid_graphics {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Get_hybrid_graphics()
+}
+
+func (g *HwService) SetOffloadSettings(settings backend.Hw_offload_settings) bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	if err := backend.Set_offload_settings(settings); err != nil {
+		log.Println("error: failed to set offload settings:", err)
+		return false
+	}
+	return true
+}
+
+// Returns the choice for each selected device and whether the installation succeeded.
+func (g *HwService) AutoInstall(request backend.Hw_auto_install) ([]backend.Hw_auto_install_choice, bool) {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Hwmgr.Auto_install(request)
+}
+
+func (g *HwService) ModuleStatus() backend.Hw_module_status {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	return backend.Get_module_status()
+}
+
+func (g *HwService) BlacklistModule(module string) bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	if err := backend.Set_module_blacklisted(module, true); err != nil {
+		log.Println("error: failed to blacklist module:", err)
+		return false
+	}
+	return true
+}
+
+func (g *HwService) UnblacklistModule(module string) bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	if err := backend.Set_module_blacklisted(module, false); err != nil {
+		log.Println("error: failed to unblacklist module:", err)
+		return false
+	}
+	return true
+}
+
+func (g *HwService) SetModuleOptions(module, options string) bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	if err := backend.Set_module_options(module, options); err != nil {
+		log.Println("error: failed to set module options:", err)
+		return false
+	}
+	return true
 }
 
-func (g *HwService) RemoveConfig(name string) {
-	backend.Hwmgr.Remove_pci_config(name)
+func (g *HwService) RebuildInitramfs() bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	if err := backend.Rebuild_initramfs(); err != nil {
+		log.Println("error:", err)
+		return false
+	}
+	return true
 }
 
 func (g *HwService) InstallFreeGpuConfig() bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
 	return backend.Hwmgr.Install_free_gpu_config()
 }
 
 func (g *HwService) InstallProprietaryGpuConfig() bool {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
 	return backend.Hwmgr.Install_proprietary_gpu_config()
 }
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"manjaro-control-panel/backend"
+	"os"
+)
+
+// Runs a config transaction of the application as root, started by the application through
+// pkexec. The request is passed as JSON, the result is printed as the last line:
+//
+//	manjaro-control-panel hw-transaction <request>
+func run_hw_transaction(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: manjaro-control-panel hw-transaction <request>")
+		return 2
+	}
+
+	var request backend.Hw_transaction_request
+	if err := json.Unmarshal([]byte(args[0]), &request); err != nil {
+		fmt.Fprintln(os.Stderr, "invalid request:", err)
+		return 2
+	}
+
+	if !backend.Run_hw_transaction(request).Ok {
+		return 1
+	}
+	return 0
+}
@@ -9,3 +9,17 @@ type LanguageService struct{}
 func (g *LanguageService) Packages() []backend.Language_package {
 	return backend.Get_language_packs()
 }
+
+// Installs the language packs of one Language_package, one locale or both, see
+// backend.Language_pack_request.
+func (g *LanguageService) Install(request backend.Language_pack_request) bool {
+	return backend.Lngmgr.Install_language_packs(request)
+}
+
+func (g *LanguageService) Remove(request backend.Language_pack_request) bool {
+	return backend.Lngmgr.Remove_language_packs(request)
+}
+
+func (g *LanguageService) InstallMissing() bool {
+	return backend.Lngmgr.Install_missing_language_packs()
+}
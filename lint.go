@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"manjaro-control-panel/backend"
+)
+
+// Validates MHWDCONFIG files instead of starting the application. Exits with 1 if errors were
+// found, or warnings in strict mode, so it can gate config repositories:
+//
+//	manjaro-control-panel lint [-json] [-strict] [dir...]
+func run_lint(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	json := flags.Bool("json", false, "print the result as JSON")
+	strict := flags.Bool("strict", false, "fail on warnings too")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: manjaro-control-panel lint [-json] [-strict] [dir...]")
+		fmt.Fprintln(flags.Output(), "Validates the MHWDCONFIG files below the directories (default: mhwd database).")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	dirs := flags.Args()
+	if len(dirs) == 0 {
+		dirs = backend.Get_lint_dirs()
+	}
+
+	result := backend.Lint_configs(dirs)
+	if *json {
+		fmt.Print(result.Json())
+	} else {
+		fmt.Print(result.Text())
+	}
+
+	if result.Errors != 0 || (*strict && result.Warnings != 0) {
+		return 1
+	}
+	return 0
+}
@@ -2,12 +2,27 @@ package main
 
 import (
 	"embed"
+	"flag"
 	"log"
 	"manjaro-control-panel/backend"
+	"os"
+	"strings"
 
 	"github.com/wailsapp/wails/v3/pkg/application"
 )
 
+// Value of a flag that may be given multiple times.
+type string_list []string
+
+func (list *string_list) String() string {
+	return strings.Join(*list, ",")
+}
+
+func (list *string_list) Set(value string) error {
+	*list = append(*list, value)
+	return nil
+}
+
 // Wails uses Go's `embed` package to embed the frontend files into the binary.
 // Any files in the frontend/dist folder will be embedded into the binary and
 // made available to the frontend.
@@ -20,6 +35,27 @@ var assets embed.FS
 // and starts a goroutine that emits a time-based event every second. It subsequently runs the application and
 // logs any error that might occur.
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "lint" {
+		os.Exit(run_lint(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hw-transaction" {
+		os.Exit(run_hw_transaction(os.Args[2:]))
+	}
+
+	var config_dirs string_list
+	flag.Var(&config_dirs, "config-dir",
+		"additional MHWDCONFIG root with pci and usb subdirectories, searched before /etc/mhwd/db and /var/lib/mhwd/db (repeatable)")
+	devices := flag.String("devices", "",
+		"replay the devices recorded in a fixture or hwinfo dump instead of probing the hardware")
+	flag.Parse()
+	backend.Hwmgr.Config_dirs = config_dirs
+
+	if *devices != "" {
+		if err := backend.Use_device_fixture(*devices); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	// TODO: this should lazy load
 	backend.Fill_devices()
 	backend.Update_configs()
@@ -36,6 +72,7 @@ func main() {
 			application.NewService(&KernelService{&backend.Krlmgr}),
 			application.NewService(&HwService{}),
 			application.NewService(&LanguageService{}),
+			application.NewService(&ReportService{}),
 		},
 		Assets: application.AssetOptions{
 			Handler: application.AssetFileServerFS(assets),
@@ -46,6 +83,13 @@ func main() {
 	})
 
 	backend.Krlmgr.App = app
+	backend.Hwmgr.App = app
+	backend.Lngmgr.App = app
+
+	// Pick up devices plugged in while the application is running
+	if *devices == "" {
+		backend.Hwmgr.Start_hotplug_monitor()
+	}
 
 	// Create a new window with the necessary options.
 	// 'Title' is the title of the window.
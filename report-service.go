@@ -0,0 +1,23 @@
+package main
+
+import (
+	"manjaro-control-panel/backend"
+)
+
+type ReportService struct{}
+
+// Returns the system report as "text", "markdown" or "json".
+func (g *ReportService) Report(format string, redact bool) string {
+	backend.Lock_hw_manager()
+	defer backend.Unlock_hw_manager()
+
+	report := backend.Generate_report(redact)
+
+	switch format {
+	case "markdown":
+		return report.Markdown()
+	case "json":
+		return report.Json()
+	}
+	return report.Text()
+}